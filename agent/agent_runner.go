@@ -1,75 +1,160 @@
-package agent
-
-import (
-	"context"
-	"fmt"
-	"net/http"
-	"revnoa/collector"
-	"revnoa/config"
-	"revnoa/handlers"
-	"revnoa/sender"
-	"revnoa/utils"
-	"time"
-)
-
-var tailer collector.Tailer
-var svr *http.Server
-
-func RunAgent(ctx context.Context, cfg *config.Config, agentID string) {
-	sender.SetBackup(cfg.RetryCount)
-	sender.SetApiKey(cfg.API.AuthKey)
-	sender.SetStorageConfig(cfg.Storage.FileBackup.Enabled, cfg.Storage.FileBackup.Dir)
-
-	// Direct Health Check
-	if cfg.API.Heartbeat != "" {
-		sender.SendHealthLoop(agentID, cfg.API.Heartbeat)
-	}
-
-	// Metrics Collection Loop
-	if cfg.API.Server != "" {
-		go StartMetricsLoop(ctx, cfg, agentID)
-	}
-
-	// Log Tailer Task
-	if cfg.Collectors.Log.Enabled {
-		tailer = NewLogTailer(cfg, agentID)
-		StartLogLoop(tailer)
-	}
-
-	// Metrics HTTP Endpoint
-	if cfg.HTTPServer.Enabled {
-		http.HandleFunc("/metrics", handlers.GetMetricsHandler(agentID, cfg))
-		portStr := fmt.Sprintf(":%d", cfg.HTTPServer.Port)
-		svr = &http.Server{Addr: portStr}
-
-		utils.InfoLogger.Printf("Agent started - Push + Pull (port %d)\n", cfg.HTTPServer.Port)
-
-		go func() {
-			if err := svr.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				utils.ErrorLogger.Fatalf("Failed to start HTTP server: %v", err)
-			}
-		}()
-	} else {
-		utils.InfoLogger.Println("Metrics GET endpoint is disabled")
-	}
-
-	// Graceful Shutdown
-	<-ctx.Done()
-	utils.InfoLogger.Printf("Shutting down agent gracefully at %s", time.Now().Format(time.RFC3339))
-
-	if tailer != nil {
-		tailer.Stop()
-		utils.InfoLogger.Println("Tailer stopped")
-	}
-
-	if svr != nil {
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		if err := svr.Shutdown(shutdownCtx); err != nil {
-			utils.ErrorLogger.Printf("HTTP server shutdown error: %v", err)
-		} else {
-			utils.InfoLogger.Println("HTTP server stopped")
-		}
-	}
-}
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"revnoa/collector"
+	"revnoa/config"
+	"revnoa/handlers"
+	"revnoa/sender"
+	"revnoa/utils"
+	"time"
+)
+
+var tailer collector.Tailer
+var svr *http.Server
+
+func RunAgent(ctx context.Context, cfg *config.Config, agentID string) {
+	sender.SetBackup(cfg.RetryCount)
+	sender.SetApiKey(cfg.API.AuthKey)
+	sender.SetBreakerConfig(sender.BreakerConfig{
+		FailureThreshold: cfg.Sender.FailureThreshold,
+		BaseBackoff:      time.Duration(cfg.Sender.BackoffBase) * time.Second,
+		MaxBackoff:       time.Duration(cfg.Sender.BackoffMax) * time.Second,
+	})
+	sender.SetStorageConfig(cfg.Storage.FileBackup.Enabled, cfg.Storage.FileBackup.Dir)
+	sender.SetReplayConfig(cfg.Storage.FileBackup.ReplayRate, cfg.Storage.FileBackup.Archive)
+
+	sender.SetClientConfig(time.Duration(cfg.Sender.Timeout)*time.Second, cfg.Sender.Concurrency)
+	sender.SetBatchConfig(sender.BatchOptions{
+		MaxItems:    cfg.Sender.BatchMaxItems,
+		MaxBytes:    cfg.Sender.BatchMaxBytes,
+		Format:      cfg.Sender.BatchFormat,
+		Compression: cfg.Sender.Compression,
+	})
+
+	if queue := openQueue(cfg, "metrics"); queue != nil {
+		sender.SetQueue(queue)
+		defer queue.Close()
+	}
+	sender.ReplayBackups(cfg.API.Server)
+
+	// Metrics Sender, stopped before the queue is closed
+	if cfg.API.Server != "" {
+		worker := sender.StartMetricsSender(ctx, cfg.API.Server, cfg.Sender.Concurrency, cfg.Sender.BufferSize)
+		defer worker.Wait()
+	}
+
+	// Log Sender, with its own context so it outlives the tailer's final
+	// flush on shutdown
+	var positions *collector.Positions
+	var logsWorker *sender.Worker
+	logsCtx, stopLogs := context.WithCancel(context.Background())
+	if cfg.Collectors.Log.Enabled {
+		positions = OpenLogPositions(cfg)
+		sender.SetLogPayloadVersion(cfg.Collectors.Log.PayloadVersion)
+		if queue := openQueue(cfg, "logs"); queue != nil {
+			sender.SetLogsQueue(queue)
+			defer queue.Close()
+		}
+		logsWorker = sender.StartLogsSender(logsCtx, cfg.API.Log, cfg.Sender.Concurrency, cfg.Sender.BufferSize, cfg.Collectors.Log.MaxPending, commitPositions(positions))
+		defer logsWorker.Wait()
+	}
+
+	// Docker Event Sender
+	if cfg.Collectors.Docker.Events {
+		if queue := openQueue(cfg, "events"); queue != nil {
+			sender.SetEventsQueue(queue)
+			defer queue.Close()
+		}
+		worker := sender.StartEventsSender(ctx, cfg.API.Events, cfg.Sender.Concurrency, cfg.Sender.BufferSize)
+		defer worker.Wait()
+	}
+
+	// Direct Health Check
+	if cfg.API.Heartbeat != "" {
+		sender.SendHealthLoop(agentID, cfg.API.Heartbeat)
+	}
+
+	// Metrics Collection Loop
+	scheduler := collector.NewScheduler(cfg, collector.EnabledCollectors(cfg))
+	if cfg.API.Server != "" {
+		go StartMetricsLoop(ctx, cfg, agentID, scheduler)
+	}
+
+	// Log Tailer Task
+	if cfg.Collectors.Log.Enabled {
+		tailer = NewLogTailer(cfg, agentID, positions)
+		StartLogLoop(tailer)
+	}
+
+	// Docker Event Watcher
+	if cfg.Collectors.Docker.Events {
+		go StartDockerEvents(ctx, cfg, agentID)
+	}
+
+	// Metrics HTTP Endpoint
+	if cfg.HTTPServer.Enabled {
+		http.HandleFunc("/metrics", handlers.GetMetricsHandler(agentID, cfg, scheduler))
+		portStr := fmt.Sprintf(":%d", cfg.HTTPServer.Port)
+		svr = &http.Server{Addr: portStr}
+
+		utils.InfoLogger.Printf("Agent started - Push + Pull (port %d)\n", cfg.HTTPServer.Port)
+
+		go func() {
+			if err := svr.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				utils.ErrorLogger.Fatalf("Failed to start HTTP server: %v", err)
+			}
+		}()
+	} else {
+		utils.InfoLogger.Println("Metrics GET endpoint is disabled")
+	}
+
+	// Graceful Shutdown
+	<-ctx.Done()
+	utils.InfoLogger.Printf("Shutting down agent gracefully at %s", time.Now().Format(time.RFC3339))
+
+	if logsWorker != nil {
+		logsWorker.Drain()
+	}
+	if tailer != nil {
+		tailer.Stop()
+		utils.InfoLogger.Println("Tailer stopped")
+	}
+	stopLogs()
+
+	if svr != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := svr.Shutdown(shutdownCtx); err != nil {
+			utils.ErrorLogger.Printf("HTTP server shutdown error: %v", err)
+		} else {
+			utils.InfoLogger.Println("HTTP server stopped")
+		}
+	}
+}
+
+// openQueue opens the disk queue <dir>/queue/<name>, or returns nil when
+// file backup is off and the in-memory queue should be used.
+func openQueue(cfg *config.Config, name string) *sender.DiskQueue {
+	backup := cfg.Storage.FileBackup
+	if !backup.Enabled || backup.Dir == "" {
+		return nil
+	}
+
+	queue, err := sender.OpenDiskQueue(sender.DiskQueueOptions{
+		Dir:          filepath.Join(backup.Dir, "queue", name),
+		SegmentBytes: backup.SegmentSize,
+		MaxBytes:     backup.MaxSize,
+		MaxAge:       time.Duration(backup.MaxAge) * time.Second,
+		Fsync:        backup.Fsync,
+	})
+	if err != nil {
+		utils.ErrorLogger.Printf("Failed to open %s disk queue, falling back to memory: %v", name, err)
+		return nil
+	}
+	return queue
+}
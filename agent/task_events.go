@@ -0,0 +1,18 @@
+package agent
+
+import (
+	"context"
+	"revnoa/collector"
+	"revnoa/config"
+	"revnoa/sender"
+)
+
+// StartDockerEvents watches the container events of the Docker daemon
+// and hands each one to the events sender until ctx is done.
+func StartDockerEvents(ctx context.Context, cfg *config.Config, agentID string) {
+	docker := cfg.Collectors.Docker
+	watcher := collector.NewDockerEventWatcher(collector.DockerOptionsFromConfig(docker), docker.Labels, func(ev collector.DockerEvent) {
+		sender.SendEvent(ev, agentID)
+	})
+	watcher.Run(ctx)
+}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"revnoa/collector"
+	"revnoa/config"
+)
+
+// RunRedact writes every line of in to out as it would be shipped after
+// the redact rules of the named log source ("default" for the rules under
+// collectors.log). It is used to try out rules on sample input offline.
+func RunRedact(cfg *config.Config, source string, in io.Reader, out io.Writer) error {
+	rules, ok := sourceRedactRules(cfg, source)
+	if !ok {
+		return fmt.Errorf("unknown log source %q", source)
+	}
+
+	redactor, err := collector.NewRedactor(redactRules(rules), cfg.Collectors.Log.RedactHashKey)
+	if err != nil {
+		return err
+	}
+	if redactor == nil {
+		return fmt.Errorf("log source %q has no redact rules", source)
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	w := bufio.NewWriter(out)
+	for scanner.Scan() {
+		fmt.Fprintln(w, redactor.Redact(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func sourceRedactRules(cfg *config.Config, source string) ([]config.RedactConfig, bool) {
+	if source == "default" {
+		return cfg.Collectors.Log.Redact, true
+	}
+	for _, src := range cfg.Collectors.Log.Sources {
+		if src.Name == source {
+			return src.Redact, true
+		}
+	}
+	return nil, false
+}
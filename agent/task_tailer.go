@@ -1,48 +1,163 @@
-package agent
-
-import (
-	"os"
-	"revnoa/collector"
-	"revnoa/config"
-	"revnoa/sender"
-	"revnoa/utils"
-)
-
-func NewLogTailer(cfg *config.Config, agentID string) collector.Tailer {
-	validFiles := make([]string, 0, len(cfg.Collectors.Log.Files))
-
-	for _, path := range cfg.Collectors.Log.Files {
-		if _, err := os.Stat(path); err == nil {
-			validFiles = append(validFiles, path)
-		} else {
-			utils.WarnLogger.Printf("Can't read log file: %s", path)
-		}
-	}
-
-	if len(validFiles) == 0 {
-		utils.WarnLogger.Println("No log files found. Skip log tail.")
-		return nil
-	}
-
-	return collector.NewTailer(
-		validFiles,
-		cfg.Collectors.Log.BufferCount,
-		cfg.Collectors.Log.FlushInterval,
-		func(lines []string) {
-			sender.SendLogs(cfg.API.Log, lines, agentID)
-		},
-	)
-}
-
-func StartLogLoop(tailer collector.Tailer) {
-	if tailer == nil {
-		utils.WarnLogger.Println("No log tailer. Skip.")
-		return
-	}
-
-	if err := tailer.Start(); err != nil {
-		utils.ErrorLogger.Printf("Fail to start log tailer: %v", err)
-	} else {
-		utils.InfoLogger.Println("Log tailer started.")
-	}
-}
+package agent
+
+import (
+	"path/filepath"
+	"revnoa/collector"
+	"revnoa/config"
+	"revnoa/sender"
+	"revnoa/utils"
+	"time"
+)
+
+// OpenLogPositions loads the registry of delivered log offsets. It returns
+// nil if the file can't be used, in which case tailing starts over.
+func OpenLogPositions(cfg *config.Config) *collector.Positions {
+	path := cfg.Collectors.Log.PositionsFile
+	if path == "" {
+		path = filepath.Join(cfg.Storage.FileBackup.Dir, "positions.json")
+	}
+
+	positions, err := collector.OpenPositions(path)
+	if err != nil {
+		utils.ErrorLogger.Printf("Failed to open positions file %s: %v", path, err)
+		return nil
+	}
+	return positions
+}
+
+// commitPositions returns the callback that stores offsets of delivered
+// log batches.
+func commitPositions(positions *collector.Positions) func([]collector.FilePosition) {
+	if positions == nil {
+		return nil
+	}
+	return func(delivered []collector.FilePosition) {
+		if err := positions.Commit(delivered); err != nil {
+			utils.ErrorLogger.Printf("Failed to save log positions: %v", err)
+		}
+	}
+}
+
+func NewLogTailer(cfg *config.Config, agentID string, positions *collector.Positions) collector.Tailer {
+	return collector.NewTailer(
+		collector.TailerConfig{
+			Files:         cfg.Collectors.Log.Files,
+			Exclude:       cfg.Collectors.Log.Exclude,
+			Multiline:     multilineRule(cfg.Collectors.Log.Multiline),
+			Parser:        parserRule(cfg.Collectors.Log.Parser),
+			Filter:        filterRule(cfg.Collectors.Log.Filter),
+			Redact:        redactRules(cfg.Collectors.Log.Redact),
+			RedactHashKey: cfg.Collectors.Log.RedactHashKey,
+			Labels:        cfg.Collectors.Log.Labels,
+			Sources:       logSources(cfg.Collectors.Log.Sources),
+			ScanInterval:  cfg.Collectors.Log.ScanInterval,
+			BufferCount:   cfg.Collectors.Log.BufferCount,
+			BufferBytes:   cfg.Collectors.Log.BufferBytes,
+			FlushInterval: cfg.Collectors.Log.FlushInterval,
+			Positions:     positions,
+			StartAtEnd:    cfg.Collectors.Log.StartAt == "end",
+		},
+		func(events []collector.LogEvent, offsets []collector.FilePosition) {
+			sender.SendLogs(events, offsets, agentID)
+		},
+	)
+}
+
+func logSources(sources []config.LogSource) []collector.LogSource {
+	out := make([]collector.LogSource, 0, len(sources))
+	for _, src := range sources {
+		out = append(out, collector.LogSource{
+			Name:      src.Name,
+			Files:     src.Files,
+			Exclude:   src.Exclude,
+			Journal:   journalRule(src.Journal),
+			Syslog:    syslogRule(src.Syslog),
+			Multiline: multilineRule(src.Multiline),
+			Parser:    parserRule(src.Parser),
+			Filter:    filterRule(src.Filter),
+			Redact:    redactRules(src.Redact),
+			Labels:    src.Labels,
+		})
+	}
+	return out
+}
+
+func journalRule(j config.JournalConfig) *collector.JournalRule {
+	if !j.Enabled {
+		return nil
+	}
+	return &collector.JournalRule{
+		Units:       j.Units,
+		Identifiers: j.Identifiers,
+		Priority:    j.Priority,
+		Directory:   j.Directory,
+	}
+}
+
+func syslogRule(s config.SyslogConfig) *collector.SyslogRule {
+	if s.UDP == "" && s.TCP == "" && s.Unix == "" {
+		return nil
+	}
+	return &collector.SyslogRule{UDP: s.UDP, TCP: s.TCP, Unix: s.Unix}
+}
+
+func multilineRule(ml config.MultilineConfig) *collector.MultilineRule {
+	if ml.Pattern == "" {
+		return nil
+	}
+	return &collector.MultilineRule{
+		Pattern:  ml.Pattern,
+		Negate:   ml.Negate,
+		Match:    ml.Match,
+		MaxLines: ml.MaxLines,
+		Timeout:  time.Duration(ml.Timeout) * time.Second,
+	}
+}
+
+func parserRule(p config.ParserConfig) *collector.ParserRule {
+	if p.Type == "" {
+		return nil
+	}
+	return &collector.ParserRule{
+		Type:       p.Type,
+		Pattern:    p.Pattern,
+		TimeField:  p.TimeField,
+		TimeFormat: p.TimeFormat,
+	}
+}
+
+func filterRule(f config.FilterConfig) *collector.FilterRule {
+	if len(f.Include) == 0 && len(f.Exclude) == 0 && len(f.DropLevels) == 0 &&
+		f.SampleRate == 0 && f.RateLimit == 0 && !f.Dedup {
+		return nil
+	}
+	return &collector.FilterRule{
+		Include:    f.Include,
+		Exclude:    f.Exclude,
+		DropLevels: f.DropLevels,
+		SampleRate: f.SampleRate,
+		RateLimit:  f.RateLimit,
+		Dedup:      f.Dedup,
+	}
+}
+
+func redactRules(rules []config.RedactConfig) []collector.RedactRule {
+	var out []collector.RedactRule
+	for _, r := range rules {
+		out = append(out, collector.RedactRule{Name: r.Name, Pattern: r.Pattern, Action: r.Action})
+	}
+	return out
+}
+
+func StartLogLoop(tailer collector.Tailer) {
+	if tailer == nil {
+		utils.WarnLogger.Println("No log tailer. Skip.")
+		return
+	}
+
+	if err := tailer.Start(); err != nil {
+		utils.ErrorLogger.Printf("Fail to start log tailer: %v", err)
+	} else {
+		utils.InfoLogger.Println("Log tailer started.")
+	}
+}
@@ -1,59 +1,320 @@
-package collector
-
-import (
-	"encoding/json"
-	"net/http"
-	"strings"
-)
-
-type DockerContainerInfo struct {
-	ID     string `json:"id"`
-	Name   string `json:"name"`
-	Image  string `json:"image"`
-	Status string `json:"status"`
-}
-
-func CollectDockerContainers() ([]DockerContainerInfo, error) {
-	resp, err := http.Get("http://localhost:2375/containers/json?all=true")
-	if err != nil {
-		return []DockerContainerInfo{
-			{ID: "-", Name: "-", Image: "-", Status: "Docker API not reachable"},
-		}, nil
-	}
-	defer resp.Body.Close()
-
-	var rawContainers []map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&rawContainers); err != nil {
-		return []DockerContainerInfo{
-			{ID: "-", Name: "-", Image: "-", Status: "Invalid JSON from Docker API"},
-		}, nil
-	}
-
-	var result []DockerContainerInfo
-	for _, c := range rawContainers {
-		id, _ := c["Id"].(string)
-		image, _ := c["Image"].(string)
-		status, _ := c["Status"].(string)
-
-		name := "-"
-		if names, ok := c["Names"].([]interface{}); ok && len(names) > 0 {
-			name, _ = names[0].(string)
-			name = strings.TrimPrefix(name, "/")
-		}
-
-		result = append(result, DockerContainerInfo{
-			ID:     trimString(id, 12),
-			Name:   name,
-			Image:  image,
-			Status: status,
-		})
-	}
-	return result, nil
-}
-
-func trimString(s string, max int) string {
-	if len(s) > max {
-		return s[:max]
-	}
-	return s
-}
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"revnoa/config"
+	"revnoa/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DockerContainerInfo describes a container. Resource usage is only
+// filled in for running containers; network and block IO are totals
+// since the container started.
+type DockerContainerInfo struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Image        string            `json:"image"`
+	Status       string            `json:"status"`
+	State        string            `json:"state,omitempty"`
+	Health       string            `json:"health,omitempty"`
+	RestartCount int               `json:"restart_count"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	CPUPercent   float64           `json:"cpu_percent,omitempty"`
+	MemoryUsage  uint64            `json:"memory_usage,omitempty"`
+	MemoryLimit  uint64            `json:"memory_limit,omitempty"`
+	NetworkRx    uint64            `json:"network_rx_bytes,omitempty"`
+	NetworkTx    uint64            `json:"network_tx_bytes,omitempty"`
+	BlockRead    uint64            `json:"block_read_bytes,omitempty"`
+	BlockWrite   uint64            `json:"block_write_bytes,omitempty"`
+	PIDs         uint64            `json:"pids,omitempty"`
+}
+
+// ContainerFilter selects the containers the collector reports. Labels
+// are Docker label filters, "key" or "key=value", all of which must
+// match.
+type ContainerFilter struct {
+	RunningOnly bool
+	Labels      []string
+}
+
+// dockerDetailWorkers bounds the containers inspected at once. Before API
+// 1.41 a stats call takes about a second while the daemon samples CPU
+// usage; later versions answer at once with one-shot stats.
+const dockerDetailWorkers = 8
+
+// dockerOneShotVersion is the first API version with one-shot stats.
+const dockerOneShotVersion = "1.41"
+
+// DockerCollector lists the containers of a Docker or Podman daemon with
+// their resource usage.
+type DockerCollector struct {
+	client *DockerClient
+	err    error
+	filter ContainerFilter
+
+	// cpu holds each container's CPU sample of the previous run, which
+	// one-shot stats don't include.
+	mu  sync.Mutex
+	cpu map[string]dockerCPUStats
+}
+
+func init() {
+	Register("docker", func(cfg *config.Config) Collector {
+		docker := cfg.Collectors.Docker
+		dc := NewDockerCollector(DockerOptionsFromConfig(docker), ContainerFilter{RunningOnly: docker.RunningOnly, Labels: docker.Labels})
+		return NewFuncCollector("docker",
+			func(cfg *config.Config) config.CollectorOptions { return cfg.Collectors.Docker.CollectorOptions },
+			dc.Collect,
+			func(m *FullMetrics, v []DockerContainerInfo) { m.Docker = v })
+	})
+}
+
+// DockerOptionsFromConfig returns the client options of the docker
+// collector config.
+func DockerOptionsFromConfig(cfg config.DockerConfig) DockerOptions {
+	return DockerOptions{
+		Host:       cfg.Host,
+		APIVersion: cfg.APIVersion,
+		TLSCA:      cfg.TLSCA,
+		TLSCert:    cfg.TLSCert,
+		TLSKey:     cfg.TLSKey,
+	}
+}
+
+// NewDockerCollector returns a collector for the daemon in opts. Invalid
+// options are reported by every Collect.
+func NewDockerCollector(opts DockerOptions, filter ContainerFilter) *DockerCollector {
+	client, err := NewDockerClient(opts)
+	return &DockerCollector{client: client, err: err, filter: filter, cpu: map[string]dockerCPUStats{}}
+}
+
+func (dc *DockerCollector) Collect(ctx context.Context) ([]DockerContainerInfo, error) {
+	if dc.err != nil {
+		return nil, dc.err
+	}
+
+	query := url.Values{}
+	if !dc.filter.RunningOnly {
+		query.Set("all", "true")
+	}
+	if len(dc.filter.Labels) > 0 {
+		filters, _ := json.Marshal(map[string][]string{"label": dc.filter.Labels})
+		query.Set("filters", string(filters))
+	}
+
+	var rawContainers []struct {
+		ID     string            `json:"Id"`
+		Names  []string          `json:"Names"`
+		Image  string            `json:"Image"`
+		Status string            `json:"Status"`
+		State  string            `json:"State"`
+		Labels map[string]string `json:"Labels"`
+	}
+	if err := dc.client.Get(ctx, "/containers/json", query, &rawContainers); err != nil {
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+
+	// Details still missing shortly before the deadline are left out, so
+	// the list itself is reported in time.
+	detailsCtx, cancel := detailsContext(ctx)
+	defer cancel()
+	oneShot := false
+	if version, err := dc.client.apiVersion(ctx); err == nil {
+		oneShot = compareVersions(version, dockerOneShotVersion) >= 0
+	}
+
+	result := make([]DockerContainerInfo, len(rawContainers))
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, dockerDetailWorkers)
+	listed := make(map[string]bool, len(rawContainers))
+	for i, c := range rawContainers {
+		listed[c.ID] = true
+		name := "-"
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		result[i] = DockerContainerInfo{
+			ID:     trimString(c.ID, 12),
+			Name:   name,
+			Image:  c.Image,
+			Status: c.Status,
+			State:  c.State,
+			Labels: c.Labels,
+		}
+
+		select {
+		case workers <- struct{}{}:
+		case <-detailsCtx.Done():
+			continue
+		}
+		wg.Add(1)
+		go func(info *DockerContainerInfo, id string) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			dc.details(detailsCtx, info, id, oneShot)
+		}(&result[i], c.ID)
+	}
+	wg.Wait()
+	if detailsCtx.Err() != nil && ctx.Err() == nil {
+		utils.WarnLogger.Printf("Details of some of %d containers missed the deadline, consider raising collectors.docker.timeout", len(rawContainers))
+	}
+
+	dc.mu.Lock()
+	for id := range dc.cpu {
+		if !listed[id] {
+			delete(dc.cpu, id)
+		}
+	}
+	dc.mu.Unlock()
+	return result, nil
+}
+
+// detailsContext ends a tenth of the remaining time before ctx, leaving
+// time to return what was collected.
+func detailsContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-time.Until(deadline)/10))
+}
+
+// details adds what inspect and, for running containers, stats report.
+// A container removed in the meantime, or one whose details can't be
+// read, is reported with what the list showed.
+func (dc *DockerCollector) details(ctx context.Context, info *DockerContainerInfo, id string, oneShot bool) {
+	var inspect struct {
+		RestartCount int `json:"RestartCount"`
+		State        struct {
+			Status string `json:"Status"`
+			Health *struct {
+				Status string `json:"Status"`
+			} `json:"Health"`
+		} `json:"State"`
+	}
+	if err := dc.client.Get(ctx, "/containers/"+id+"/json", nil, &inspect); err != nil {
+		if !IsDockerNotFound(err) && ctx.Err() == nil {
+			utils.WarnLogger.Printf("Failed to inspect container %s: %v", info.Name, err)
+		}
+		return
+	}
+	info.RestartCount = inspect.RestartCount
+	if inspect.State.Status != "" {
+		info.State = inspect.State.Status
+	}
+	if inspect.State.Health != nil {
+		info.Health = inspect.State.Health.Status
+	}
+	if info.State != "running" {
+		return
+	}
+
+	query := url.Values{"stream": {"false"}}
+	if oneShot {
+		query.Set("one-shot", "true")
+	}
+	var stats dockerStats
+	if err := dc.client.Get(ctx, "/containers/"+id+"/stats", query, &stats); err != nil {
+		if !IsDockerNotFound(err) && ctx.Err() == nil {
+			utils.WarnLogger.Printf("Failed to read stats of container %s: %v", info.Name, err)
+		}
+		return
+	}
+
+	// One-shot stats leave precpu_stats empty; the sample of the previous
+	// run takes its place.
+	dc.mu.Lock()
+	if stats.PreCPUStats.SystemUsage == 0 {
+		stats.PreCPUStats = dc.cpu[id]
+	}
+	dc.cpu[id] = stats.CPUStats
+	dc.mu.Unlock()
+	stats.apply(info)
+}
+
+// dockerStats is the part of a /containers/{id}/stats reply the
+// collector reports.
+type dockerStats struct {
+	CPUStats    dockerCPUStats `json:"cpu_stats"`
+	PreCPUStats dockerCPUStats `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	PidsStats struct {
+		Current uint64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+type dockerCPUStats struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`
+		PercpuUsage []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  int    `json:"online_cpus"`
+}
+
+// apply computes usage the way `docker stats` shows it: CPU percent of
+// one core, summed over cores, and memory without the page cache.
+func (s *dockerStats) apply(info *DockerContainerInfo) {
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	cpus := s.CPUStats.OnlineCPUs
+	if cpus == 0 {
+		cpus = len(s.CPUStats.CPUUsage.PercpuUsage)
+	}
+	if s.PreCPUStats.SystemUsage > 0 && cpuDelta > 0 && systemDelta > 0 {
+		info.CPUPercent = cpuDelta / systemDelta * float64(cpus) * 100
+	}
+
+	// cgroup v1 reports the cache as total_inactive_file, v2 as
+	// inactive_file.
+	info.MemoryUsage = s.MemoryStats.Usage
+	cache, ok := s.MemoryStats.Stats["total_inactive_file"]
+	if !ok {
+		cache = s.MemoryStats.Stats["inactive_file"]
+	}
+	if cache < info.MemoryUsage {
+		info.MemoryUsage -= cache
+	}
+	info.MemoryLimit = s.MemoryStats.Limit
+
+	for _, n := range s.Networks {
+		info.NetworkRx += n.RxBytes
+		info.NetworkTx += n.TxBytes
+	}
+	for _, io := range s.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(io.Op) {
+		case "read":
+			info.BlockRead += io.Value
+		case "write":
+			info.BlockWrite += io.Value
+		}
+	}
+	info.PIDs = s.PidsStats.Current
+}
+
+func trimString(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
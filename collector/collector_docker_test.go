@@ -0,0 +1,264 @@
+package collector
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDocker serves handler on a Unix socket and returns its host URL.
+func fakeDocker(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	// Socket paths are limited to about 100 bytes, shorter than some
+	// temporary directories.
+	dir, err := os.MkdirTemp("", "docker")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	srv := &http.Server{Handler: handler}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return "unix://" + socket
+}
+
+// dockerAPI answers /_ping with version and the versioned paths in routes.
+func dockerAPI(version string, routes map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_ping" {
+			if version != "" {
+				w.Header().Set("Api-Version", version)
+			}
+			w.Write([]byte("OK"))
+			return
+		}
+		body, ok := routes[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"page not found"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	})
+}
+
+func TestDockerCollectorUnixSocket(t *testing.T) {
+	host := fakeDocker(t, dockerAPI("1.41", map[string]string{
+		"/v1.41/containers/json": `[
+			{"Id":"0123456789abcdef","Names":["/web"],"Image":"nginx:1.27","Status":"Up 3 hours"},
+			{"Id":"fedcba9876543210","Names":[],"Image":"redis","Status":"Exited (0) 2 days ago"}
+		]`,
+	}))
+
+	containers, err := NewDockerCollector(DockerOptions{Host: host}, ContainerFilter{}).Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []DockerContainerInfo{
+		{ID: "0123456789ab", Name: "web", Image: "nginx:1.27", Status: "Up 3 hours"},
+		{ID: "fedcba987654", Name: "-", Image: "redis", Status: "Exited (0) 2 days ago"},
+	}, containers)
+}
+
+func TestDockerVersionNegotiation(t *testing.T) {
+	cases := map[string]string{
+		"1.45": "1.43",
+		"1.41": "1.41",
+		"":     "1.24",
+	}
+	for server, want := range cases {
+		client, err := NewDockerClient(DockerOptions{Host: fakeDocker(t, dockerAPI(server, nil))})
+		require.NoError(t, err)
+		version, err := client.apiVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, want, version, server)
+	}
+
+	client, err := NewDockerClient(DockerOptions{Host: fakeDocker(t, dockerAPI("1.12", nil))})
+	require.NoError(t, err)
+	_, err = client.apiVersion(context.Background())
+	assert.ErrorContains(t, err, "older than 1.24")
+
+	// A pinned version is used without asking the daemon.
+	client, err = NewDockerClient(DockerOptions{Host: "unix:///nonexistent.sock", APIVersion: "1.40"})
+	require.NoError(t, err)
+	version, err := client.apiVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "1.40", version)
+}
+
+func TestDockerCollectorErrors(t *testing.T) {
+	_, err := NewDockerCollector(DockerOptions{Host: "unix:///nonexistent/docker.sock"}, ContainerFilter{}).Collect(context.Background())
+	assert.ErrorContains(t, err, "not reachable")
+
+	host := fakeDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_ping" {
+			w.Header().Set("Api-Version", "1.43")
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"message":"daemon is shutting down"}`))
+	}))
+	containers, err := NewDockerCollector(DockerOptions{Host: host}, ContainerFilter{}).Collect(context.Background())
+	assert.Nil(t, containers)
+	var de *DockerError
+	require.ErrorAs(t, err, &de)
+	assert.Equal(t, http.StatusInternalServerError, de.Status)
+	assert.Equal(t, "daemon is shutting down", de.Message)
+
+	_, err = NewDockerCollector(DockerOptions{Host: "npipe:////./pipe/docker_engine"}, ContainerFilter{}).Collect(context.Background())
+	assert.ErrorContains(t, err, "unsupported docker host")
+}
+
+func TestDockerClientTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(dockerAPI("1.43", map[string]string{"/v1.43/containers/json": `[]`}))
+	defer srv.Close()
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644))
+	host := "tcp://" + strings.TrimPrefix(srv.URL, "https://")
+
+	containers, err := NewDockerCollector(DockerOptions{Host: host, TLSCA: ca}, ContainerFilter{}).Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, containers)
+
+	// Without TLS options the client speaks plain HTTP, which the daemon refuses.
+	_, err = NewDockerCollector(DockerOptions{Host: host}, ContainerFilter{}).Collect(context.Background())
+	assert.Error(t, err)
+
+	_, err = NewDockerClient(DockerOptions{Host: host, TLSCert: ca, TLSKey: ca})
+	assert.ErrorContains(t, err, "client certificate")
+}
+
+func TestDockerCollectorStats(t *testing.T) {
+	var listQuery url.Values
+	api := dockerAPI("1.43", map[string]string{
+		"/v1.43/containers/json": `[
+			{"Id":"aaaaaaaaaaaaaaaa","Names":["/api"],"Image":"api:2","Status":"Up 1 hour (healthy)","State":"running","Labels":{"team":"payments"}},
+			{"Id":"bbbbbbbbbbbbbbbb","Names":["/gone"],"Image":"job","Status":"Up 1 second","State":"running"}
+		]`,
+		"/v1.43/containers/aaaaaaaaaaaaaaaa/json": `{"RestartCount":2,"State":{"Status":"running","Health":{"Status":"healthy"}}}`,
+		"/v1.43/containers/aaaaaaaaaaaaaaaa/stats": `{
+			"cpu_stats":{"cpu_usage":{"total_usage":300000000},"system_cpu_usage":2000000000,"online_cpus":4},
+			"precpu_stats":{"cpu_usage":{"total_usage":100000000},"system_cpu_usage":1000000000},
+			"memory_stats":{"usage":104857600,"limit":536870912,"stats":{"inactive_file":4857600}},
+			"networks":{"eth0":{"rx_bytes":1000,"tx_bytes":2000},"eth1":{"rx_bytes":10,"tx_bytes":20}},
+			"blkio_stats":{"io_service_bytes_recursive":[{"op":"read","value":4096},{"op":"write","value":8192},{"op":"Read","value":4096}]},
+			"pids_stats":{"current":12}
+		}`,
+	})
+	host := fakeDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1.43/containers/json" {
+			listQuery = r.URL.Query()
+		}
+		api.ServeHTTP(w, r)
+	}))
+
+	filter := ContainerFilter{RunningOnly: true, Labels: []string{"team=payments"}}
+	containers, err := NewDockerCollector(DockerOptions{Host: host}, filter).Collect(context.Background())
+	require.NoError(t, err)
+
+	assert.Empty(t, listQuery.Get("all"))
+	assert.JSONEq(t, `{"label":["team=payments"]}`, listQuery.Get("filters"))
+
+	require.Len(t, containers, 2)
+	assert.Equal(t, DockerContainerInfo{
+		ID:           "aaaaaaaaaaaa",
+		Name:         "api",
+		Image:        "api:2",
+		Status:       "Up 1 hour (healthy)",
+		State:        "running",
+		Health:       "healthy",
+		RestartCount: 2,
+		Labels:       map[string]string{"team": "payments"},
+		CPUPercent:   80,
+		MemoryUsage:  100000000,
+		MemoryLimit:  536870912,
+		NetworkRx:    1010,
+		NetworkTx:    2020,
+		BlockRead:    8192,
+		BlockWrite:   8192,
+		PIDs:         12,
+	}, containers[0])
+
+	// A container removed after the list is reported as listed.
+	assert.Equal(t, DockerContainerInfo{ID: "bbbbbbbbbbbb", Name: "gone", Image: "job", Status: "Up 1 second", State: "running"}, containers[1])
+}
+
+func TestDockerCollectorOneShotStats(t *testing.T) {
+	var mu sync.Mutex
+	var statsQuery url.Values
+	usage := 100000000
+	host := fakeDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/_ping":
+			w.Header().Set("Api-Version", "1.43")
+		case "/v1.43/containers/json":
+			w.Write([]byte(`[{"Id":"aaaaaaaaaaaaaaaa","Names":["/api"],"State":"running"}]`))
+		case "/v1.43/containers/aaaaaaaaaaaaaaaa/json":
+			w.Write([]byte(`{"State":{"Status":"running"}}`))
+		case "/v1.43/containers/aaaaaaaaaaaaaaaa/stats":
+			statsQuery = r.URL.Query()
+			fmt.Fprintf(w, `{"cpu_stats":{"cpu_usage":{"total_usage":%d},"system_cpu_usage":%d,"online_cpus":2}}`, usage, usage*10)
+			usage *= 2
+		}
+	}))
+
+	dc := NewDockerCollector(DockerOptions{Host: host}, ContainerFilter{})
+	containers, err := dc.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "true", statsQuery.Get("one-shot"))
+	assert.Zero(t, containers[0].CPUPercent, "no earlier sample to compare with")
+
+	// The next run compares with the sample kept from the first.
+	containers, err = dc.Collect(context.Background())
+	require.NoError(t, err)
+	assert.InDelta(t, 20, containers[0].CPUPercent, 0.001)
+}
+
+func TestDockerCollectorDeadline(t *testing.T) {
+	utils.InitLogger(true)
+	release := make(chan struct{})
+	defer close(release)
+	host := fakeDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_ping":
+			w.Header().Set("Api-Version", "1.40")
+		case "/v1.40/containers/json":
+			w.Write([]byte(`[{"Id":"aaaaaaaaaaaaaaaa","Names":["/api"],"Status":"Up","State":"running"}]`))
+		case "/v1.40/containers/aaaaaaaaaaaaaaaa/json":
+			w.Write([]byte(`{"State":{"Status":"running"}}`))
+		default:
+			// Stats that take longer than the collector may.
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	containers, err := NewDockerCollector(DockerOptions{Host: host}, ContainerFilter{}).Collect(ctx)
+	require.NoError(t, err)
+	assert.NoError(t, ctx.Err(), "returned before the deadline")
+	assert.Equal(t, []DockerContainerInfo{{ID: "aaaaaaaaaaaa", Name: "api", Status: "Up", State: "running"}}, containers)
+}
@@ -1,13 +1,14 @@
 package collector
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCollectCpu(t *testing.T) {
-	cpuStats, err := CollectCpu()
+	cpuStats, err := CollectCpu(context.Background())
 	assert.NoError(t, err)
 	assert.NotNil(t, cpuStats)
 	assert.GreaterOrEqual(t, cpuStats.Cores, 1)
@@ -15,7 +16,7 @@ func TestCollectCpu(t *testing.T) {
 }
 
 func TestCollectMemory(t *testing.T) {
-	memStats, err := CollectMemory()
+	memStats, err := CollectMemory(context.Background())
 	assert.NoError(t, err)
 	assert.NotNil(t, memStats)
 	assert.Greater(t, memStats.Total, uint64(0))
@@ -24,21 +25,21 @@ func TestCollectMemory(t *testing.T) {
 }
 
 func TestCollectDisks(t *testing.T) {
-	disks, err := CollectDisks()
+	disks, err := CollectDisks(context.Background())
 	assert.NoError(t, err)
 	assert.NotNil(t, disks)
 	// allow empty slice
 }
 
 func TestCollectNetStats(t *testing.T) {
-	netStats, err := CollectNetStats()
+	netStats, err := CollectNetStats(context.Background())
 	assert.NoError(t, err)
 	assert.NotNil(t, netStats)
 	assert.GreaterOrEqual(t, netStats.BytesSent, uint64(0))
 }
 
 func TestCollectHostInfo(t *testing.T) {
-	host, err := CollectHostInfo()
+	host, err := CollectHostInfo(context.Background())
 	assert.NoError(t, err)
 	assert.NotNil(t, host)
 	assert.NotEmpty(t, host.Hostname)
@@ -46,7 +47,7 @@ func TestCollectHostInfo(t *testing.T) {
 }
 
 func TestCollectOpenPorts(t *testing.T) {
-	ports, err := CollectOpenPorts()
+	ports, err := CollectOpenPorts(context.Background())
 	// allow errors if command not available
 	if err == nil {
 		assert.NotNil(t, ports)
@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisCollectorTimeout(t *testing.T) {
+	utils.InitLogger(true)
+
+	// A server that accepts connections but never answers.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	rc := NewRedisCollector(ln.Addr().String())
+	c := NewFuncCollector("redis", nil, rc.Collect, func(m *FullMetrics, v *RedisMetrics) { m.Redis = v })
+	_, err = RunCollector(context.Background(), c, 200*time.Millisecond)
+	assert.ErrorIs(t, err, ErrCollectTimeout)
+
+	// A server that is down is a sample of its own.
+	ln.Close()
+	metrics, err := rc.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "unreachable", metrics.Status)
+}
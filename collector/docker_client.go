@@ -0,0 +1,258 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultDockerHost is the Docker daemon socket on Linux and macOS.
+	DefaultDockerHost = "unix:///var/run/docker.sock"
+
+	// dockerMaxVersion is the newest API version the client speaks, and
+	// dockerMinVersion the oldest one with every endpoint it uses.
+	dockerMaxVersion = "1.43"
+	dockerMinVersion = "1.24"
+)
+
+// DockerOptions configures NewDockerClient. Host is a unix:// socket or
+// a tcp:// address; empty uses $DOCKER_HOST, or the first Docker or
+// Podman socket found. APIVersion pins the API version instead of
+// negotiating it. TLSCA, TLSCert and TLSKey are PEM files for tcp://
+// hosts: the CA that signed the daemon's certificate and the client
+// certificate and key.
+type DockerOptions struct {
+	Host       string
+	APIVersion string
+	TLSCA      string
+	TLSCert    string
+	TLSKey     string
+}
+
+// DockerClient talks to the Docker Engine API, or the compatible API of
+// Podman. The API version is negotiated with the daemon on first use.
+type DockerClient struct {
+	host   string
+	base   string
+	client *http.Client
+
+	mu      sync.Mutex
+	version string
+}
+
+// DockerError is a failed API call, with the status and message the
+// daemon replied with.
+type DockerError struct {
+	Status  int
+	Message string
+}
+
+func (e *DockerError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("docker API returned %d", e.Status)
+	}
+	return fmt.Sprintf("docker API returned %d: %s", e.Status, e.Message)
+}
+
+// NewDockerClient returns a client for opts.Host. It does not connect
+// until the first request.
+func NewDockerClient(opts DockerOptions) (*DockerClient, error) {
+	host := opts.Host
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = detectDockerHost()
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", host, err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	c := &DockerClient{host: host, version: opts.APIVersion}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		// The host name is not used, but must be valid in a URL.
+		c.base = "http://docker"
+	case "tcp":
+		if opts.TLSCA == "" && opts.TLSCert == "" && opts.TLSKey == "" {
+			c.base = "http://" + u.Host
+			break
+		}
+		tlsConfig, err := dockerTLSConfig(opts)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+		c.base = "https://" + u.Host
+	default:
+		return nil, fmt.Errorf("unsupported docker host %q, use unix:// or tcp://", host)
+	}
+	c.client = &http.Client{Transport: transport}
+	return c, nil
+}
+
+// detectDockerHost returns the first of the Docker socket, the rootful
+// Podman socket and the user's Podman socket that exists, or the Docker
+// socket if none does.
+func detectDockerHost() string {
+	candidates := []string{"/var/run/docker.sock", "/run/podman/podman.sock"}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "podman", "podman.sock"))
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return "unix://" + path
+		}
+	}
+	return DefaultDockerHost
+}
+
+func dockerTLSConfig(opts DockerOptions) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.TLSCA != "" {
+		pem, err := os.ReadFile(opts.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("docker TLS CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("docker TLS CA %s holds no certificates", opts.TLSCA)
+		}
+		config.RootCAs = pool
+	}
+	if opts.TLSCert != "" || opts.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(opts.TLSCert, opts.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("docker TLS client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// apiVersion returns the version to call the API with: the pinned one,
+// or the newest one both the daemon and the client speak, asked for once
+// with /_ping.
+func (c *DockerClient) apiVersion(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != "" {
+		return c.version, nil
+	}
+
+	resp, err := c.do(ctx, "/_ping")
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	server := resp.Header.Get("Api-Version")
+	version := dockerMaxVersion
+	switch {
+	case server == "":
+		// Daemons older than 1.25 don't tell; they all speak 1.24.
+		version = dockerMinVersion
+	case compareVersions(server, dockerMinVersion) < 0:
+		return "", fmt.Errorf("docker API version %s is older than %s", server, dockerMinVersion)
+	case compareVersions(server, version) < 0:
+		version = server
+	}
+	c.version = version
+	return version, nil
+}
+
+// Get calls the API at path and decodes the JSON reply into out.
+func (c *DockerClient) Get(ctx context.Context, path string, query url.Values, out any) error {
+	resp, err := c.Stream(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Stream calls the API at path and returns the reply for the caller to
+// read and close, such as a stream of events.
+func (c *DockerClient) Stream(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	version, err := c.apiVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	path = "/v" + version + path
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return c.do(ctx, path)
+}
+
+func (c *DockerClient) do(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker daemon at %s not reachable: %w", c.host, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var reply struct {
+			Message string `json:"message"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(body, &reply) != nil {
+			reply.Message = strings.TrimSpace(string(body))
+		}
+		return nil, &DockerError{Status: resp.StatusCode, Message: reply.Message}
+	}
+	return resp, nil
+}
+
+// compareVersions compares API versions such as "1.41" numerically.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// IsDockerNotFound reports whether err is a 404 from the API, such as for
+// a container that was removed.
+func IsDockerNotFound(err error) bool {
+	var de *DockerError
+	return errors.As(err, &de) && de.Status == http.StatusNotFound
+}
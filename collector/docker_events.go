@@ -0,0 +1,213 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"revnoa/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DockerEvent is a container lifecycle event. Action is the Docker
+// action, such as start, die or oom; for health_status the new status is
+// in Health. ExitCode is set for die. Attributes holds the rest of what
+// the daemon reported, mostly the container's labels.
+type DockerEvent struct {
+	Time       time.Time         `json:"time"`
+	Action     string            `json:"action"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Image      string            `json:"image,omitempty"`
+	Health     string            `json:"health,omitempty"`
+	ExitCode   *int              `json:"exit_code,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// dockerEventActions are the container events the watcher asks for.
+var dockerEventActions = []string{
+	"create", "start", "restart", "stop", "kill", "die", "oom",
+	"pause", "unpause", "destroy", "health_status",
+}
+
+// The watcher reconnects after dockerEventsRetry, doubling the delay up to
+// dockerEventsMaxRetry while the daemon stays unreachable.
+var (
+	dockerEventsRetry    = time.Second
+	dockerEventsMaxRetry = 30 * time.Second
+)
+
+// DockerEventWatcher follows the event stream of a Docker or Podman
+// daemon and hands each container event to send as it arrives.
+type DockerEventWatcher struct {
+	client *DockerClient
+	err    error
+	labels []string
+	send   func(DockerEvent)
+
+	// since is the time of the last event seen, or when the last stream
+	// opened if that was later; a new connection asks for the events
+	// after it, so none are lost or repeated.
+	since time.Time
+}
+
+// NewDockerEventWatcher returns a watcher for the daemon in opts. Labels
+// are Docker label filters, "key" or "key=value", all of which a
+// container must have for its events to be sent.
+func NewDockerEventWatcher(opts DockerOptions, labels []string, send func(DockerEvent)) *DockerEventWatcher {
+	client, err := NewDockerClient(opts)
+	return &DockerEventWatcher{client: client, err: err, labels: labels, send: send}
+}
+
+// Run watches events until ctx is done. When the stream fails or the
+// daemon closes it, Run reconnects and resumes after the last event seen,
+// or after the last stream opened if no event came through it.
+func (w *DockerEventWatcher) Run(ctx context.Context) {
+	if w.err != nil {
+		utils.ErrorLogger.Printf("Not watching Docker events: %v", w.err)
+		return
+	}
+
+	utils.InfoLogger.Println("Watching Docker events")
+	delay := dockerEventsRetry
+	for {
+		seen, err := w.watch(ctx)
+		if ctx.Err() != nil {
+			utils.InfoLogger.Println("Stopped watching Docker events")
+			return
+		}
+		if seen {
+			delay = dockerEventsRetry
+		}
+		utils.WarnLogger.Printf("Docker event stream failed, reconnecting in %s: %v", delay, err)
+
+		select {
+		case <-ctx.Done():
+			utils.InfoLogger.Println("Stopped watching Docker events")
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, dockerEventsMaxRetry)
+	}
+}
+
+// watch reads one connection to the event stream until it ends. It
+// reports whether any event was received, so the retry delay starts over
+// after a connection that worked.
+func (w *DockerEventWatcher) watch(ctx context.Context) (bool, error) {
+	resp, err := w.client.Stream(ctx, "/events", w.query())
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	// Every event from here on comes through this stream, so the next
+	// connection can start here even if none arrives before it drops.
+	if opened := streamOpened(resp); opened.After(w.since) {
+		w.since = opened
+	}
+
+	seen := false
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var raw dockerRawEvent
+		if err := dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("closed by the daemon")
+			}
+			return seen, err
+		}
+		seen = true
+
+		ev := raw.event()
+		if ev.Time.After(w.since) {
+			w.since = ev.Time
+		}
+		w.send(ev)
+	}
+}
+
+// streamOpened returns when the daemon opened the stream, by its own
+// clock as given in the Date header, or by ours if there is none. Date
+// has whole seconds, which only makes it earlier.
+func streamOpened(resp *http.Response) time.Time {
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		return date
+	}
+	return time.Now()
+}
+
+// query selects container events with the watcher's labels, after the
+// last event seen. Docker includes events at since itself, so the query
+// starts one nanosecond later.
+func (w *DockerEventWatcher) query() url.Values {
+	filters := map[string][]string{
+		"type":  {"container"},
+		"event": dockerEventActions,
+	}
+	if len(w.labels) > 0 {
+		filters["label"] = w.labels
+	}
+	data, _ := json.Marshal(filters)
+
+	query := url.Values{"filters": {string(data)}}
+	if !w.since.IsZero() {
+		since := w.since.Add(time.Nanosecond)
+		query.Set("since", fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()))
+	}
+	return query
+}
+
+// dockerRawEvent is an event as the API sends it.
+type dockerRawEvent struct {
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	Time     int64 `json:"time"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+func (raw dockerRawEvent) event() DockerEvent {
+	ev := DockerEvent{Action: raw.Action, ID: raw.Actor.ID}
+	if raw.TimeNano != 0 {
+		ev.Time = time.Unix(0, raw.TimeNano)
+	} else {
+		ev.Time = time.Unix(raw.Time, 0)
+	}
+	if len(ev.ID) > 12 {
+		ev.ID = ev.ID[:12]
+	}
+	// Health changes arrive as "health_status: healthy".
+	if action, status, ok := strings.Cut(raw.Action, ":"); ok {
+		ev.Action, ev.Health = action, strings.TrimSpace(status)
+	}
+
+	attrs := map[string]string{}
+	for name, value := range raw.Actor.Attributes {
+		switch name {
+		case "name":
+			ev.Name = value
+		case "image":
+			ev.Image = value
+		case "exitCode":
+			if code, err := strconv.Atoi(value); err == nil {
+				ev.ExitCode = &code
+				continue
+			}
+			attrs[name] = value
+		default:
+			attrs[name] = value
+		}
+	}
+	if len(attrs) > 0 {
+		ev.Attributes = attrs
+	}
+	return ev
+}
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerEventWatcher(t *testing.T) {
+	utils.InitLogger(true)
+	defer func(old time.Duration) { dockerEventsRetry = old }(dockerEventsRetry)
+	dockerEventsRetry = 10 * time.Millisecond
+
+	var mu sync.Mutex
+	var queries []url.Values
+	host := fakeDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_ping" {
+			w.Header().Set("Api-Version", "1.43")
+			return
+		}
+		require.Equal(t, "/v1.43/events", r.URL.Path)
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		n := len(queries)
+		mu.Unlock()
+
+		switch n {
+		case 1:
+			// The daemon closes the stream after two events.
+			w.Header().Set("Date", time.Unix(1699999999, 0).UTC().Format(http.TimeFormat))
+			fmt.Fprintln(w, `{"Type":"container","Action":"health_status: unhealthy","Actor":{"ID":"aaaaaaaaaaaaaaaa","Attributes":{"name":"api","image":"api:2","team":"payments"}},"time":1700000000,"timeNano":1700000000000000001}`)
+			fmt.Fprintln(w, `{"Type":"container","Action":"die","Actor":{"ID":"aaaaaaaaaaaaaaaa","Attributes":{"name":"api","image":"api:2","exitCode":"137"}},"time":1700000000,"timeNano":1700000000500000000}`)
+		case 2:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"message":"daemon is restarting"}`))
+		case 3:
+			// The stream opens and drops before any event arrives.
+			w.Header().Set("Date", time.Unix(1700000005, 0).UTC().Format(http.TimeFormat))
+		default:
+			fmt.Fprintln(w, `{"Type":"container","Action":"oom","Actor":{"ID":"bbbbbbbbbbbbbbbb","Attributes":{"name":"job"}},"time":1700000006,"timeNano":1700000006000000000}`)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	}))
+
+	events := make(chan DockerEvent, 10)
+	watcher := NewDockerEventWatcher(DockerOptions{Host: host}, []string{"team=payments"}, func(ev DockerEvent) { events <- ev })
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watcher.Run(ctx)
+	}()
+
+	var got []DockerEvent
+	for len(got) < 3 {
+		select {
+		case ev := <-events:
+			got = append(got, ev)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of 3 events", len(got))
+		}
+	}
+	cancel()
+	<-done
+
+	exitCode := 137
+	assert.Equal(t, []DockerEvent{
+		{Time: time.Unix(0, 1700000000000000001), Action: "health_status", Health: "unhealthy", ID: "aaaaaaaaaaaa", Name: "api", Image: "api:2", Attributes: map[string]string{"team": "payments"}},
+		{Time: time.Unix(0, 1700000000500000000), Action: "die", ID: "aaaaaaaaaaaa", Name: "api", Image: "api:2", ExitCode: &exitCode},
+		{Time: time.Unix(1700000006, 0), Action: "oom", ID: "bbbbbbbbbbbb", Name: "job"},
+	}, got)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, queries, 4)
+	assert.JSONEq(t, `{
+		"type": ["container"],
+		"event": ["create", "start", "restart", "stop", "kill", "die", "oom", "pause", "unpause", "destroy", "health_status"],
+		"label": ["team=payments"]
+	}`, queries[0].Get("filters"))
+	assert.False(t, queries[0].Has("since"))
+	// Reconnects resume after the last event seen, also after a failed attempt.
+	assert.Equal(t, "1700000000.500000001", queries[1].Get("since"))
+	assert.Equal(t, "1700000000.500000001", queries[2].Get("since"))
+	// A stream that opened but saw no event still moves since forward.
+	assert.Equal(t, "1700000005.000000001", queries[3].Get("since"))
+}
@@ -0,0 +1,295 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"revnoa/utils"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JournalRule selects the systemd journal entries a source reads. Units,
+// Identifiers and Priority work like journalctl's -u, -t and -p: entries
+// must match one of the units and one of the identifiers, and be at least
+// as severe as Priority (a name such as "warning", a number, or a range
+// like "err..info"). Directory reads the journal files in that directory
+// instead of the system journal.
+type JournalRule struct {
+	Units       []string
+	Identifiers []string
+	Priority    string
+	Directory   string
+}
+
+// journalctl is the command the journal is read through.
+var journalctl = "journalctl"
+
+const (
+	journalRestartDelay = 5 * time.Second
+	// journalMaxLine bounds one JSON entry, which holds every field.
+	journalMaxLine = 4 << 20
+)
+
+// journalKey is the positions entry holding the cursor of a source.
+func journalKey(source string) string {
+	return "journal:" + source
+}
+
+// journalArgs builds the journalctl command line. Reading continues after
+// cursor if there is one, otherwise at the end of the journal with
+// startAtEnd or from its start.
+func journalArgs(rule *JournalRule, cursor string, startAtEnd bool) []string {
+	args := []string{"--output=json", "--follow", "--no-pager", "--all"}
+	if rule.Directory != "" {
+		args = append(args, "--directory="+rule.Directory)
+	}
+	for _, unit := range rule.Units {
+		args = append(args, "--unit="+unit)
+	}
+	for _, id := range rule.Identifiers {
+		args = append(args, "--identifier="+id)
+	}
+	if rule.Priority != "" {
+		args = append(args, "--priority="+rule.Priority)
+	}
+	switch {
+	case cursor != "":
+		args = append(args, "--after-cursor="+cursor)
+	case startAtEnd:
+		args = append(args, "--lines=0")
+	default:
+		args = append(args, "--no-tail")
+	}
+	return args
+}
+
+// followJournal reads a journal source until ctx is done, restarting
+// journalctl after the cursor of the last entry read if it exits. Entries
+// are redacted, their MESSAGE parsed by the source's parser, and then
+// passed through its filter like file lines.
+func followJournal(ctx context.Context, src LogSource, stages sourceStages, cfg TailerConfig, out chan<- tailedEvent) {
+	if runtime.GOOS != "linux" {
+		utils.ErrorLogger.Printf("Journal source %s is only supported on Linux", src.Name)
+		return
+	}
+
+	var cursor string
+	if cfg.Positions != nil {
+		cursor, _ = cfg.Positions.Cursor(journalKey(src.Name))
+	}
+	if cursor != "" {
+		utils.InfoLogger.Printf("Resuming journal source %s after cursor %s", src.Name, cursor)
+	}
+
+	r := newJournalReader(ctx, src, stages, out)
+	for {
+		args := journalArgs(src.Journal, cursor, cfg.StartAtEnd)
+		if err := r.run(exec.CommandContext(ctx, journalctl, args...)); err != nil && ctx.Err() == nil {
+			utils.WarnLogger.Printf("journalctl for %s stopped: %v", src.Name, err)
+		}
+		if r.cursor != "" {
+			cursor = r.cursor
+		}
+
+		select {
+		case <-ctx.Done():
+			utils.InfoLogger.Printf("Stopped reading journal: %s", src.Name)
+			return
+		case <-time.After(journalRestartDelay):
+		}
+	}
+}
+
+// journalReader turns the JSON entries written by journalctl into events.
+type journalReader struct {
+	src    LogSource
+	parser *eventParser
+	stages sourceStages
+	sink   *sink
+
+	// cursor is the cursor of the last entry read.
+	cursor string
+}
+
+func newJournalReader(ctx context.Context, src LogSource, stages sourceStages, out chan<- tailedEvent) *journalReader {
+	parser, err := newEventParser(src.Parser)
+	if err != nil {
+		utils.ErrorLogger.Printf("Invalid parser for %s, sending raw messages: %v", src.Name, err)
+	}
+	return &journalReader{
+		src:    src,
+		parser: parser,
+		stages: stages,
+		sink:   newSink(ctx, src, stages, out),
+	}
+}
+
+// run starts cmd and reads its output until it exits.
+func (r *journalReader) run(cmd *exec.Cmd) error {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	r.read(stdout)
+	if err := cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// read handles the entries of in, one JSON object per line, until it is
+// exhausted. Events held by dedup are sent once no entry arrives within
+// the dedup window, and when in ends.
+func (r *journalReader) read(in io.Reader) {
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), journalMaxLine)
+		for scanner.Scan() {
+			select {
+			case lines <- bytes.Clone(scanner.Bytes()):
+			case <-r.sink.ctx.Done():
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil && r.sink.ctx.Err() == nil {
+			utils.WarnLogger.Printf("Failed to read journal for %s: %v", r.src.Name, err)
+		}
+	}()
+
+	idle := time.NewTimer(time.Hour)
+	idle.Stop()
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-r.sink.ctx.Done():
+			return
+		case <-idle.C:
+			r.sink.flush()
+		case line, ok := <-lines:
+			if !ok {
+				r.sink.flush()
+				return
+			}
+			r.entry(line)
+			if r.sink.pending() {
+				idle.Reset(r.sink.dd.window)
+			} else {
+				idle.Stop()
+			}
+		}
+	}
+}
+
+// entry turns one journal entry into an event. The journal fields, except
+// MESSAGE and the "__" address fields, become event fields; the parser's
+// fields take precedence over them. The position stores the entry's
+// cursor, with its realtime timestamp as the offset so that older
+// positions never overwrite newer ones.
+func (r *journalReader) entry(line []byte) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(line, &raw); err != nil {
+		utils.WarnLogger.Printf("Skipping malformed journal entry for %s: %v", r.src.Name, err)
+		return
+	}
+
+	fields := make(map[string]any, len(raw))
+	for name, value := range raw {
+		fields[name] = journalValue(value)
+	}
+	cursor, _ := fields["__CURSOR"].(string)
+	if cursor == "" {
+		return
+	}
+	r.cursor = cursor
+
+	pos := FilePosition{Path: journalKey(r.src.Name), Cursor: cursor}
+	var at time.Time
+	if usec, err := strconv.ParseInt(fieldString(fields["__REALTIME_TIMESTAMP"]), 10, 64); err == nil {
+		at = time.UnixMicro(usec)
+		pos.Offset = usec
+	}
+
+	message := fieldString(fields["MESSAGE"])
+	for name := range fields {
+		if name == "MESSAGE" || strings.HasPrefix(name, "__") {
+			delete(fields, name)
+		} else {
+			fields[name] = r.redact(fields[name])
+		}
+	}
+
+	ev := r.parser.event(r.stages.redactor.Redact(message))
+	for name, value := range ev.Fields {
+		fields[name] = value
+	}
+	ev.Fields = fields
+	if ev.Time.IsZero() {
+		ev.Time = at
+	}
+	ev.Source, ev.Labels, ev.ReadAt = r.src.Name, r.src.Labels, time.Now()
+	r.sink.add(ev, pos)
+}
+
+// redact applies the source's redaction to a field value, including every
+// value of a repeated field.
+func (r *journalReader) redact(value any) any {
+	switch v := value.(type) {
+	case string:
+		return r.stages.redactor.Redact(v)
+	case []any:
+		for i := range v {
+			v[i] = r.redact(v[i])
+		}
+	}
+	return value
+}
+
+// journalValue decodes a journal field. journalctl writes binary values
+// as arrays of bytes and repeated fields as arrays of values.
+func journalValue(raw json.RawMessage) any {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var data []byte
+	var bytesValue []int
+	if json.Unmarshal(raw, &bytesValue) == nil {
+		for _, b := range bytesValue {
+			data = append(data, byte(b))
+		}
+		return string(data)
+	}
+	var values []json.RawMessage
+	if json.Unmarshal(raw, &values) == nil {
+		list := make([]any, 0, len(values))
+		for _, v := range values {
+			list = append(list, journalValue(v))
+		}
+		return list
+	}
+	return nil
+}
+
+func fieldString(v any) string {
+	s, _ := v.(string)
+	return s
+}
@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalArgs(t *testing.T) {
+	rule := &JournalRule{Units: []string{"nginx.service", "api.service"}, Identifiers: []string{"nginx"}, Priority: "warning", Directory: "/var/log/journal"}
+	assert.Equal(t, []string{
+		"--output=json", "--follow", "--no-pager", "--all",
+		"--directory=/var/log/journal",
+		"--unit=nginx.service", "--unit=api.service",
+		"--identifier=nginx",
+		"--priority=warning",
+		"--after-cursor=s=1;i=2",
+	}, journalArgs(rule, "s=1;i=2", true))
+
+	assert.Equal(t, "--lines=0", journalArgs(&JournalRule{}, "", true)[4])
+	assert.Equal(t, "--no-tail", journalArgs(&JournalRule{}, "", false)[4])
+}
+
+func TestJournalReaderFixture(t *testing.T) {
+	utils.InitLogger(true)
+	fixture, err := os.Open(filepath.Join("testdata", "journal.json"))
+	require.NoError(t, err)
+	defer fixture.Close()
+
+	src := LogSource{Name: "journal", Journal: &JournalRule{}, Parser: &ParserRule{Type: ParserJSON}, Labels: map[string]string{"env": "prod"}}
+	redactor, err := NewRedactor([]RedactRule{{Name: "password"}}, "")
+	require.NoError(t, err)
+	out := make(chan tailedEvent, 10)
+	r := newJournalReader(context.Background(), src, sourceStages{redactor: redactor}, out)
+	r.read(fixture)
+	close(out)
+
+	var got []tailedEvent
+	for item := range out {
+		got = append(got, item)
+	}
+	require.Len(t, got, 3)
+	assert.Equal(t, "s=1;i=3", r.cursor)
+
+	first := got[0]
+	assert.Equal(t, `{"status":200,"path":"/healthz"}`, first.ev.Text)
+	assert.Equal(t, map[string]any{
+		"_SYSTEMD_UNIT":     "nginx.service",
+		"SYSLOG_IDENTIFIER": "nginx",
+		"PRIORITY":          "6",
+		"_PID":              "812",
+		"status":            float64(200),
+		"path":              "/healthz",
+	}, first.ev.Fields)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), first.ev.Time.UTC())
+	assert.Equal(t, "journal", first.ev.Source)
+	assert.Equal(t, map[string]string{"env": "prod"}, first.ev.Labels)
+	assert.Equal(t, FilePosition{Path: "journal:journal", Offset: 1735689600000000, Cursor: "s=1;i=1"}, first.pos)
+
+	assert.Equal(t, "upstream\ntimed out", got[1].ev.Text)
+	assert.Equal(t, "3", got[1].ev.Fields["PRIORITY"])
+
+	assert.Equal(t, "login failed password=[REDACTED]", got[2].ev.Text)
+	assert.Equal(t, []any{"auth.go", "login.go"}, got[2].ev.Fields["CODE_FILE"])
+	assert.Equal(t, []any{"--user=bob", "password=[REDACTED]"}, got[2].ev.Fields["ARGS"], "every value of a repeated field is redacted")
+	assert.Equal(t, "s=1;i=3", got[2].pos.Cursor)
+}
+
+func TestTailerJournalSource(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("journal sources are only read on Linux")
+	}
+	utils.InitLogger(true)
+	dir := t.TempDir()
+	fixture, err := filepath.Abs(filepath.Join("testdata", "journal.json"))
+	require.NoError(t, err)
+
+	// A stand-in journalctl that records its arguments and prints the fixture.
+	argsFile := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "journalctl")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > "+argsFile+"\ncat "+fixture+"\n"), 0755))
+	defer func(old string) { journalctl = old }(journalctl)
+	journalctl = script
+
+	positions, err := OpenPositions(filepath.Join(dir, "positions.json"))
+	require.NoError(t, err)
+	require.NoError(t, positions.Commit([]FilePosition{{Path: journalKey("system"), Offset: 1, Cursor: "s=1;i=0"}}))
+
+	var mu sync.Mutex
+	var got []LogEvent
+	cfg := TailerConfig{
+		Sources: []LogSource{{
+			Name:    "system",
+			Journal: &JournalRule{Units: []string{"nginx.service"}},
+			Filter:  &FilterRule{Exclude: []string{"healthz"}},
+		}},
+		BufferCount:   10,
+		FlushInterval: 1,
+		Positions:     positions,
+	}
+	tailer := NewTailer(cfg, func(events []LogEvent, delivered []FilePosition) {
+		require.NoError(t, positions.Commit(delivered))
+		mu.Lock()
+		got = append(got, events...)
+		mu.Unlock()
+	})
+	require.NoError(t, tailer.Start())
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 2
+	}, 5*time.Second, 20*time.Millisecond)
+	tailer.Stop()
+
+	args, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Equal(t, "--output=json --follow --no-pager --all --unit=nginx.service --after-cursor=s=1;i=0", strings.TrimSpace(string(args)))
+
+	cursor, ok := positions.Cursor(journalKey("system"))
+	assert.True(t, ok)
+	assert.Equal(t, "s=1;i=3", cursor)
+}
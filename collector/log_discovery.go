@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DiscoverFiles returns the regular files matching any of patterns and
+// none of excludes, sorted. Patterns use filepath.Match syntax per path
+// segment, plus "**" for any number of directories. An exclude pattern
+// without a separator is matched against the file name only.
+func DiscoverFiles(patterns, excludes []string) []string {
+	seen := map[string]bool{}
+	var files []string
+
+	for _, pattern := range patterns {
+		for _, file := range expandPattern(pattern) {
+			if seen[file] || isExcluded(file, excludes) {
+				continue
+			}
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func expandPattern(pattern string) []string {
+	pattern = filepath.Clean(pattern)
+
+	if !strings.Contains(pattern, "**") {
+		matches, _ := filepath.Glob(pattern)
+		return regularFiles(matches)
+	}
+
+	var files []string
+	filepath.WalkDir(walkRoot(pattern), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && matchPattern(pattern, path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// walkRoot is the longest leading directory of pattern without wildcards.
+func walkRoot(pattern string) string {
+	segs := splitPath(pattern)
+	n := 0
+	for n < len(segs) && !hasMeta(segs[n]) {
+		n++
+	}
+
+	root := strings.Join(segs[:n], string(filepath.Separator))
+	switch {
+	case filepath.IsAbs(pattern) && !filepath.IsAbs(root):
+		root = string(filepath.Separator) + root
+	case root == "":
+		root = "."
+	}
+	return root
+}
+
+// matchPattern matches path against pattern segment by segment, with "**"
+// matching zero or more segments.
+func matchPattern(pattern, path string) bool {
+	return matchSegments(splitPath(pattern), splitPath(filepath.Clean(path)))
+}
+
+func matchSegments(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+func isExcluded(file string, excludes []string) bool {
+	for _, pattern := range excludes {
+		if !strings.ContainsAny(pattern, `/\`) {
+			if ok, _ := filepath.Match(pattern, filepath.Base(file)); ok {
+				return true
+			}
+			continue
+		}
+		if matchPattern(filepath.Clean(pattern), file) {
+			return true
+		}
+	}
+	return false
+}
+
+func regularFiles(paths []string) []string {
+	files := paths[:0]
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+			files = append(files, p)
+		}
+	}
+	return files
+}
+
+func splitPath(path string) []string {
+	var segs []string
+	for _, s := range strings.Split(filepath.ToSlash(path), "/") {
+		if s != "" {
+			segs = append(segs, s)
+		}
+	}
+	return segs
+}
+
+func hasMeta(seg string) bool {
+	return strings.ContainsAny(seg, `*?[`) || (filepath.Separator != '\\' && strings.Contains(seg, `\`))
+}
@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func touch(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestDiscoverFiles(t *testing.T) {
+	dir := t.TempDir()
+	touch(t, filepath.Join(dir, "app.log"), "")
+	touch(t, filepath.Join(dir, "app.log.gz"), "")
+	touch(t, filepath.Join(dir, "svc", "a", "revnoa_2025-01-01.log"), "")
+	touch(t, filepath.Join(dir, "svc", "b", "c", "revnoa_2025-01-02.log"), "")
+	touch(t, filepath.Join(dir, "svc", "debug", "revnoa_2025-01-02.log"), "")
+
+	got := DiscoverFiles([]string{filepath.Join(dir, "*.log*")}, []string{"*.gz"})
+	assert.Equal(t, []string{filepath.Join(dir, "app.log")}, got)
+
+	got = DiscoverFiles(
+		[]string{filepath.Join(dir, "**", "revnoa_*.log")},
+		[]string{filepath.Join(dir, "svc", "debug", "**")},
+	)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "svc", "a", "revnoa_2025-01-01.log"),
+		filepath.Join(dir, "svc", "b", "c", "revnoa_2025-01-02.log"),
+	}, got)
+}
+
+func TestMatchPatternDoubleStar(t *testing.T) {
+	assert.True(t, matchPattern("/var/log/**/*.log", "/var/log/a.log"))
+	assert.True(t, matchPattern("/var/log/**/*.log", "/var/log/x/y/a.log"))
+	assert.False(t, matchPattern("/var/log/**/*.log", "/var/lib/a.log"))
+	assert.True(t, matchPattern("/var/**", "/var/log/a.log"))
+}
+
+func TestTailerPicksUpNewFiles(t *testing.T) {
+	utils.InitLogger(true)
+	dir := t.TempDir()
+	touch(t, filepath.Join(dir, "day1.log"), "first\n")
+
+	var mu sync.Mutex
+	var got []string
+	cfg := TailerConfig{
+		Files:         []string{filepath.Join(dir, "*.log")},
+		ScanInterval:  1,
+		BufferCount:   1,
+		FlushInterval: 1,
+	}
+	tailer := NewTailer(cfg, func(events []LogEvent, _ []FilePosition) {
+		mu.Lock()
+		for _, ev := range events {
+			got = append(got, ev.Text)
+		}
+		mu.Unlock()
+	})
+	require.NoError(t, tailer.Start())
+	defer tailer.Stop()
+
+	touch(t, filepath.Join(dir, "day2.log"), "second\n")
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 2
+	}, 5*time.Second, 20*time.Millisecond)
+
+	mu.Lock()
+	assert.ElementsMatch(t, []string{"first", "second"}, got)
+	mu.Unlock()
+}
@@ -0,0 +1,264 @@
+package collector
+
+import (
+	"context"
+	"math/rand/v2"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"revnoa/config"
+)
+
+// Names of the filter rules, as reported in drop counters.
+const (
+	DropInclude   = "include"
+	DropExclude   = "exclude"
+	DropLevel     = "level"
+	DropDedup     = "dedup"
+	DropSample    = "sample"
+	DropRateLimit = "rate_limit"
+)
+
+// The "logs" collector reports the drop counters with the metrics while
+// the log collector is enabled.
+func init() {
+	RegisterFunc("logs",
+		func(cfg *config.Config) config.CollectorOptions {
+			return config.CollectorOptions{Enabled: cfg.Collectors.Log.Enabled}
+		},
+		func(ctx context.Context) ([]LogDropCount, error) { return DroppedLines(), nil },
+		func(m *FullMetrics, v []LogDropCount) { m.LogDrops = v })
+}
+
+// dedupWindow bounds how long identical lines are collapsed into one event.
+const dedupWindow = 5 * time.Second
+
+// FilterRule thins out the events of a source before they are buffered.
+// An event is kept if it matches one of Include (when set) and none of
+// Exclude, and its parsed level is not in DropLevels. With Dedup,
+// identical consecutive events of a file are sent once with a repeat
+// count. Of the remaining events a SampleRate fraction is kept (0 keeps
+// all), and at most RateLimit per second (0 is unlimited).
+type FilterRule struct {
+	Include    []string
+	Exclude    []string
+	DropLevels []string
+	SampleRate float64
+	RateLimit  int
+	Dedup      bool
+}
+
+// logFilter is the compiled FilterRule of one source. It is shared by
+// the followers of all its files.
+type logFilter struct {
+	source  string
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	levels  map[string]bool
+	rate    float64
+	limiter *rateLimiter
+	dedup   bool
+}
+
+func newLogFilter(source string, rule *FilterRule) (*logFilter, error) {
+	if rule == nil {
+		return nil, nil
+	}
+
+	f := &logFilter{source: source, rate: rule.SampleRate, dedup: rule.Dedup}
+	var err error
+	if f.include, err = compileAll(rule.Include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compileAll(rule.Exclude); err != nil {
+		return nil, err
+	}
+	if len(rule.DropLevels) > 0 {
+		f.levels = make(map[string]bool, len(rule.DropLevels))
+		for _, level := range rule.DropLevels {
+			f.levels[strings.ToLower(level)] = true
+		}
+	}
+	if rule.RateLimit > 0 {
+		f.limiter = &rateLimiter{limit: rule.RateLimit}
+	}
+	return f, nil
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// match applies the include, exclude and level rules.
+func (f *logFilter) match(ev LogEvent) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.include) > 0 && !matchAny(f.include, ev.Text) {
+		countDrop(f.source, DropInclude, 1)
+		return false
+	}
+	if matchAny(f.exclude, ev.Text) {
+		countDrop(f.source, DropExclude, 1)
+		return false
+	}
+	if f.levels != nil && f.levels[eventLevel(ev)] {
+		countDrop(f.source, DropLevel, 1)
+		return false
+	}
+	return true
+}
+
+// sample applies sampling and the rate limit to an event that passed
+// match and deduplication.
+func (f *logFilter) sample(ev LogEvent) bool {
+	if f == nil {
+		return true
+	}
+	lines := max(ev.Repeat, 1)
+	if f.rate > 0 && f.rate < 1 && rand.Float64() >= f.rate {
+		countDrop(f.source, DropSample, lines)
+		return false
+	}
+	if f.limiter != nil && !f.limiter.allow(time.Now()) {
+		countDrop(f.source, DropRateLimit, lines)
+		return false
+	}
+	return true
+}
+
+func matchAny(res []*regexp.Regexp, text string) bool {
+	for _, re := range res {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// eventLevel returns the lower-cased level field of a parsed event.
+func eventLevel(ev LogEvent) string {
+	for _, name := range []string{"level", "lvl", "severity"} {
+		if s, ok := ev.Fields[name].(string); ok {
+			return strings.ToLower(s)
+		}
+	}
+	return ""
+}
+
+// rateLimiter allows up to limit events per one-second window.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Time
+	count  int
+}
+
+func (r *rateLimiter) allow(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.window) >= time.Second {
+		r.window = now
+		r.count = 0
+	}
+	if r.count >= r.limit {
+		return false
+	}
+	r.count++
+	return true
+}
+
+// dedup collapses identical consecutive events of one file. An event is
+// held until a different one arrives or window has passed since it was
+// first seen, and is then emitted with the number of repeats.
+type dedup struct {
+	source string
+	window time.Duration
+
+	held  *LogEvent
+	pos   FilePosition
+	since time.Time
+}
+
+func (d *dedup) add(ev LogEvent, pos FilePosition, emit func(LogEvent, FilePosition)) {
+	if d.held != nil && d.held.Text == ev.Text && time.Since(d.since) < d.window {
+		d.held.Repeat++
+		d.pos = pos
+		return
+	}
+	d.flush(emit)
+
+	ev.Repeat = 1
+	d.held, d.pos, d.since = &ev, pos, time.Now()
+}
+
+// flush emits the held event, if any.
+func (d *dedup) flush(emit func(LogEvent, FilePosition)) {
+	if d.held == nil {
+		return
+	}
+	ev := *d.held
+	d.held = nil
+	if ev.Repeat > 1 {
+		countDrop(d.source, DropDedup, ev.Repeat-1)
+	}
+	emit(ev, d.pos)
+}
+
+func (d *dedup) pending() bool {
+	return d.held != nil
+}
+
+// LogDropCount is the number of lines a filter rule dropped from a source.
+type LogDropCount struct {
+	Source string `json:"source"`
+	Rule   string `json:"rule"`
+	Lines  uint64 `json:"lines"`
+}
+
+type dropKey struct {
+	source string
+	rule   string
+}
+
+var (
+	dropsMu sync.Mutex
+	drops   = map[dropKey]uint64{}
+)
+
+func countDrop(source, rule string, lines int) {
+	dropsMu.Lock()
+	defer dropsMu.Unlock()
+	drops[dropKey{source, rule}] += uint64(lines)
+}
+
+// DroppedLines returns the drop counters of all sources since startup,
+// sorted by source and rule.
+func DroppedLines() []LogDropCount {
+	dropsMu.Lock()
+	defer dropsMu.Unlock()
+
+	counts := make([]LogDropCount, 0, len(drops))
+	for k, n := range drops {
+		counts = append(counts, LogDropCount{Source: k.source, Rule: k.rule, Lines: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Source != counts[j].Source {
+			return counts[i].Source < counts[j].Source
+		}
+		return counts[i].Rule < counts[j].Rule
+	})
+	return counts
+}
@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resetDrops clears the drop counters, which are global.
+func resetDrops() {
+	dropsMu.Lock()
+	defer dropsMu.Unlock()
+	drops = map[dropKey]uint64{}
+}
+
+func dropped(source, rule string) uint64 {
+	for _, d := range DroppedLines() {
+		if d.Source == source && d.Rule == rule {
+			return d.Lines
+		}
+	}
+	return 0
+}
+
+func TestLogFilterMatch(t *testing.T) {
+	resetDrops()
+	f, err := newLogFilter("filter-match", &FilterRule{
+		Include:    []string{`^\{`},
+		Exclude:    []string{`/healthz`},
+		DropLevels: []string{"DEBUG"},
+	})
+	require.NoError(t, err)
+
+	assert.False(t, f.match(LogEvent{Text: "plain"}))
+	assert.False(t, f.match(LogEvent{Text: `{"path":"/healthz"}`}))
+	assert.False(t, f.match(LogEvent{Text: `{}`, Fields: map[string]any{"level": "debug"}}))
+	assert.True(t, f.match(LogEvent{Text: `{}`, Fields: map[string]any{"level": "info"}}))
+
+	assert.Equal(t, uint64(1), dropped("filter-match", DropInclude))
+	assert.Equal(t, uint64(1), dropped("filter-match", DropExclude))
+	assert.Equal(t, uint64(1), dropped("filter-match", DropLevel))
+
+	_, err = newLogFilter("bad", &FilterRule{Exclude: []string{"("}})
+	assert.Error(t, err)
+}
+
+func TestLogFilterSampling(t *testing.T) {
+	resetDrops()
+	f, err := newLogFilter("filter-sample", &FilterRule{SampleRate: 0.5})
+	require.NoError(t, err)
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		if f.sample(LogEvent{Text: "x"}) {
+			kept++
+		}
+	}
+	assert.InDelta(t, 500, kept, 100)
+	assert.Equal(t, uint64(1000-kept), dropped("filter-sample", DropSample))
+
+	r := &rateLimiter{limit: 2}
+	now := time.Now()
+	assert.True(t, r.allow(now))
+	assert.True(t, r.allow(now.Add(100*time.Millisecond)))
+	assert.False(t, r.allow(now.Add(200*time.Millisecond)))
+	assert.True(t, r.allow(now.Add(time.Second)))
+}
+
+func TestDedupCollapsesRepeats(t *testing.T) {
+	resetDrops()
+	d := &dedup{source: "filter-dedup", window: time.Minute}
+	var got []LogEvent
+	var positions []int64
+	emit := func(ev LogEvent, pos FilePosition) {
+		got = append(got, ev)
+		positions = append(positions, pos.Offset)
+	}
+
+	for i, text := range []string{"a", "a", "a", "b", "a"} {
+		d.add(LogEvent{Text: text}, FilePosition{Offset: int64(i + 1)}, emit)
+	}
+	d.flush(emit)
+
+	require.Len(t, got, 3)
+	assert.Equal(t, LogEvent{Text: "a", Repeat: 3}, got[0])
+	assert.Equal(t, LogEvent{Text: "b", Repeat: 1}, got[1])
+	assert.Equal(t, LogEvent{Text: "a", Repeat: 1}, got[2])
+	assert.Equal(t, []int64{3, 4, 5}, positions)
+	assert.Equal(t, uint64(2), dropped("filter-dedup", DropDedup))
+}
+
+func TestTailerFiltersEvents(t *testing.T) {
+	resetDrops()
+	utils.InitLogger(true)
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(logFile, []byte("GET /healthz\nretry\nretry\nretry\ndone\n"), 0644))
+
+	var mu sync.Mutex
+	var got []LogEvent
+	cfg := TailerConfig{
+		Sources: []LogSource{{
+			Name:   "filter-tailer",
+			Files:  []string{logFile},
+			Filter: &FilterRule{Exclude: []string{"healthz"}, Dedup: true},
+		}},
+		BufferCount:   1,
+		FlushInterval: 1,
+	}
+	tailer := NewTailer(cfg, func(events []LogEvent, _ []FilePosition) {
+		mu.Lock()
+		got = append(got, events...)
+		mu.Unlock()
+	})
+	require.NoError(t, tailer.Start())
+	defer tailer.Stop()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 2
+	}, 10*time.Second, 20*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, got, 2)
+	assert.Equal(t, "retry", got[0].Text)
+	assert.Equal(t, 3, got[0].Repeat)
+	assert.Equal(t, "done", got[1].Text)
+	assert.Equal(t, 1, got[1].Repeat)
+	assert.Equal(t, uint64(1), dropped("filter-tailer", DropExclude))
+	assert.Equal(t, uint64(2), dropped("filter-tailer", DropDedup))
+}
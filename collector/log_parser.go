@@ -0,0 +1,285 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ParserJSON   = "json"
+	ParserLogfmt = "logfmt"
+	ParserRegex  = "regex"
+	ParserNginx  = "nginx"
+	ParserApache = "apache"
+	ParserSyslog = "syslog"
+)
+
+// combinedTime is the timestamp layout of combined access logs.
+const combinedTime = "02/Jan/2006:15:04:05 -0700"
+
+// ParserRule selects how the lines of a source are parsed. Pattern is the
+// named-group regex for the regex parser. TimeField names the field holding
+// the event time and TimeFormat its Go layout; without a layout common
+// formats and Unix epochs are tried.
+type ParserRule struct {
+	Type       string
+	Pattern    string
+	TimeField  string
+	TimeFormat string
+}
+
+// LogEvent is one line, or one multiline event, read from a file. Fields
+// and Time are set when the source has a parser and the line matched it.
+// Repeat counts the identical consecutive lines the event stands for when
+// deduplication is on. Offset is the byte offset of the event's first
+// line in Path, and ReadAt the time it was read.
+type LogEvent struct {
+	Text   string
+	Fields map[string]any
+	Time   time.Time
+	Repeat int
+
+	Source string
+	Path   string
+	Offset int64
+	ReadAt time.Time
+	Labels map[string]string
+}
+
+// Parser extracts fields from a line. ok is false if the line does not
+// have the expected format.
+type Parser interface {
+	Parse(line string) (fields map[string]any, ok bool)
+}
+
+// combinedPattern matches the nginx and Apache "combined" access log format.
+var combinedPattern = regexp.MustCompile(`^(?P<remote_addr>\S+) \S+ (?P<remote_user>\S+) \[(?P<time>[^\]]+)\] "(?P<method>\S+) (?P<path>\S+)(?: (?P<protocol>[^"]*))?" (?P<status>\d{3}) (?P<body_bytes>\d+|-)(?: "(?P<referer>[^"]*)" "(?P<user_agent>[^"]*)")?`)
+
+// eventParser wraps a Parser with timestamp extraction.
+type eventParser struct {
+	parser     Parser
+	timeField  string
+	timeFormat string
+}
+
+func newEventParser(rule *ParserRule) (*eventParser, error) {
+	if rule == nil || rule.Type == "" {
+		return nil, nil
+	}
+
+	p := &eventParser{timeField: rule.TimeField, timeFormat: rule.TimeFormat}
+	switch rule.Type {
+	case ParserJSON:
+		p.parser = jsonParser{}
+	case ParserLogfmt:
+		p.parser = logfmtParser{}
+	case ParserRegex:
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		p.parser = regexParser{re: re}
+	case ParserNginx, ParserApache:
+		p.parser = regexParser{re: combinedPattern, ints: []string{"status", "body_bytes"}}
+		if p.timeFormat == "" {
+			p.timeFormat = combinedTime
+		}
+	case ParserSyslog:
+		p.parser = syslogParser{}
+	default:
+		return nil, fmt.Errorf("unknown parser %q", rule.Type)
+	}
+	return p, nil
+}
+
+// event parses text into a LogEvent. Lines that don't match are kept as
+// plain text.
+func (p *eventParser) event(text string) LogEvent {
+	ev := LogEvent{Text: text}
+	if p == nil {
+		return ev
+	}
+
+	fields, ok := p.parser.Parse(text)
+	if !ok {
+		return ev
+	}
+	ev.Fields = fields
+	ev.Time, _ = eventTime(fields, p.timeField, p.timeFormat)
+	return ev
+}
+
+// eventTime finds the event time in fields, either in timeField or in one
+// of the usual field names.
+func eventTime(fields map[string]any, timeField, layout string) (time.Time, bool) {
+	names := []string{timeField}
+	if timeField == "" {
+		names = []string{"time", "timestamp", "ts", "@timestamp"}
+	}
+
+	for _, name := range names {
+		if v, ok := fields[name]; ok {
+			if t, ok := parseTime(v, layout); ok {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	combinedTime,
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+func parseTime(v any, layout string) (time.Time, bool) {
+	switch val := v.(type) {
+	case time.Time:
+		return val, true
+	case float64:
+		return epochTime(val), true
+	case int:
+		return epochTime(float64(val)), true
+	case string:
+		if layout != "" {
+			t, err := time.Parse(layout, val)
+			return t, err == nil
+		}
+		for _, l := range timeLayouts {
+			if t, err := time.Parse(l, val); err == nil {
+				return t, true
+			}
+		}
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return epochTime(f), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// epochTime reads seconds, or milliseconds for values too large to be
+// seconds.
+func epochTime(v float64) time.Time {
+	if v > 1e11 {
+		return time.UnixMilli(int64(v))
+	}
+	sec := int64(v)
+	return time.Unix(sec, int64((v-float64(sec))*1e9))
+}
+
+type jsonParser struct{}
+
+func (jsonParser) Parse(line string) (map[string]any, bool) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return nil, false
+	}
+	return fields, true
+}
+
+type logfmtParser struct{}
+
+// Parse reads key=value pairs separated by spaces. Values may be quoted;
+// a key without "=" is recorded as true. A line without any pair is not
+// logfmt.
+func (logfmtParser) Parse(line string) (map[string]any, bool) {
+	fields := map[string]any{}
+	pairs := 0
+	i := 0
+	for i < len(line) {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			if i < len(line) {
+				return nil, false
+			}
+			break
+		}
+		if i >= len(line) || line[i] == ' ' {
+			fields[key] = true
+			continue
+		}
+		i++ // '='
+		pairs++
+
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, false
+			}
+			value, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				return nil, false
+			}
+			fields[key] = value
+			i = end + 1
+			continue
+		}
+
+		start = i
+		for i < len(line) && line[i] != ' ' {
+			i++
+		}
+		fields[key] = line[start:i]
+	}
+	return fields, pairs > 0
+}
+
+type regexParser struct {
+	re   *regexp.Regexp
+	ints []string
+}
+
+func (p regexParser) Parse(line string) (map[string]any, bool) {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+
+	fields := map[string]any{}
+	for i, name := range p.re.SubexpNames() {
+		if name == "" || m[i] == "" {
+			continue
+		}
+		fields[name] = m[i]
+	}
+	for _, name := range p.ints {
+		if s, ok := fields[name].(string); ok {
+			if n, err := strconv.Atoi(s); err == nil {
+				fields[name] = n
+			}
+		}
+	}
+	return fields, true
+}
+
+type syslogParser struct{}
+
+func (syslogParser) Parse(line string) (map[string]any, bool) {
+	msg, err := ParseSyslog([]byte(strings.TrimRight(line, "\r\n")), time.Local)
+	if err != nil {
+		return nil, false
+	}
+	return msg.Fields(), true
+}
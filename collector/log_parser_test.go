@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parse(t *testing.T, rule ParserRule, line string) LogEvent {
+	t.Helper()
+	p, err := newEventParser(&rule)
+	require.NoError(t, err)
+	return p.event(line)
+}
+
+func TestParseJSON(t *testing.T) {
+	ev := parse(t, ParserRule{Type: ParserJSON}, `{"level":"error","msg":"boom","ts":1735689600.5}`)
+	assert.Equal(t, "error", ev.Fields["level"])
+	assert.Equal(t, "boom", ev.Fields["msg"])
+	assert.Equal(t, time.Unix(1735689600, 5e8), ev.Time)
+
+	ev = parse(t, ParserRule{Type: ParserJSON}, "not json")
+	assert.Nil(t, ev.Fields)
+	assert.True(t, ev.Time.IsZero())
+	assert.Equal(t, "not json", ev.Text)
+}
+
+func TestParseLogfmt(t *testing.T) {
+	ev := parse(t, ParserRule{Type: ParserLogfmt, TimeField: "at", TimeFormat: "2006-01-02 15:04:05"},
+		`at="2025-01-01 12:00:00" level=warn msg="disk \"sda\" full" retry`)
+	assert.Equal(t, map[string]any{
+		"at":    "2025-01-01 12:00:00",
+		"level": "warn",
+		"msg":   `disk "sda" full`,
+		"retry": true,
+	}, ev.Fields)
+	assert.Equal(t, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), ev.Time)
+
+	ev = parse(t, ParserRule{Type: ParserLogfmt}, "plain text line")
+	assert.Nil(t, ev.Fields)
+}
+
+func TestParseRegex(t *testing.T) {
+	ev := parse(t, ParserRule{Type: ParserRegex, Pattern: `^(?P<time>\S+) \[(?P<level>\w+)\] (?P<message>.*)$`},
+		"2025-01-01T12:00:00Z [INFO] started")
+	assert.Equal(t, map[string]any{"time": "2025-01-01T12:00:00Z", "level": "INFO", "message": "started"}, ev.Fields)
+	assert.Equal(t, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), ev.Time.UTC())
+
+	_, err := newEventParser(&ParserRule{Type: ParserRegex, Pattern: "("})
+	assert.Error(t, err)
+	_, err = newEventParser(&ParserRule{Type: "xml"})
+	assert.Error(t, err)
+}
+
+func TestParseCombinedAccessLog(t *testing.T) {
+	ev := parse(t, ParserRule{Type: ParserNginx},
+		`10.0.0.1 - alice [01/Jan/2025:12:00:00 +0900] "GET /api/v1/items?id=3 HTTP/1.1" 404 153 "-" "curl/8.0"`)
+	assert.Equal(t, map[string]any{
+		"remote_addr": "10.0.0.1",
+		"remote_user": "alice",
+		"time":        "01/Jan/2025:12:00:00 +0900",
+		"method":      "GET",
+		"path":        "/api/v1/items?id=3",
+		"protocol":    "HTTP/1.1",
+		"status":      404,
+		"body_bytes":  153,
+		"referer":     "-",
+		"user_agent":  "curl/8.0",
+	}, ev.Fields)
+	assert.Equal(t, time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC), ev.Time.UTC())
+}
+
+func TestParseSyslog(t *testing.T) {
+	msg, err := ParseSyslog([]byte(`<165>1 2025-01-01T12:00:00.5Z web01 nginx 42 ID7 [meta seq="1" note="a\]b"] request done`), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 20, msg.Facility)
+	assert.Equal(t, 5, msg.Severity)
+	assert.Equal(t, 1, msg.Version)
+	assert.Equal(t, time.Date(2025, 1, 1, 12, 0, 0, 5e8, time.UTC), msg.Timestamp.UTC())
+	assert.Equal(t, "web01", msg.Hostname)
+	assert.Equal(t, "nginx", msg.AppName)
+	assert.Equal(t, "42", msg.ProcID)
+	assert.Equal(t, "ID7", msg.MsgID)
+	assert.Equal(t, `[meta seq="1" note="a\]b"]`, msg.StructuredData)
+	assert.Equal(t, map[string]map[string]string{"meta": {"seq": "1", "note": "a]b"}}, msg.Params())
+	assert.Equal(t, "request done", msg.Message)
+
+	msg, err = ParseSyslog([]byte("<13>1 - - - - - -"), nil)
+	require.NoError(t, err)
+	assert.True(t, msg.Timestamp.IsZero())
+	assert.Equal(t, "", msg.Message)
+
+	msg, err = ParseSyslog([]byte("<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed"), time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, 4, msg.Facility)
+	assert.Equal(t, 2, msg.Severity)
+	assert.Equal(t, time.October, msg.Timestamp.Month())
+	assert.Equal(t, 22, msg.Timestamp.Hour())
+	assert.Equal(t, "mymachine", msg.Hostname)
+	assert.Equal(t, "su", msg.AppName)
+	assert.Equal(t, "123", msg.ProcID)
+	assert.Equal(t, "'su root' failed", msg.Message)
+
+	_, err = ParseSyslog([]byte("<999>oops"), nil)
+	assert.Error(t, err)
+}
+
+func TestParseSyslogFileLine(t *testing.T) {
+	ev := parse(t, ParserRule{Type: ParserSyslog}, "Jan  2 03:04:05 host sshd[77]: Accepted publickey")
+	assert.Equal(t, "sshd", ev.Fields["app_name"])
+	assert.Equal(t, "Accepted publickey", ev.Fields["message"])
+	assert.NotContains(t, ev.Fields, "severity")
+	assert.Equal(t, 3, ev.Time.Hour())
+}
+
+func TestTailerSendsParsedEvents(t *testing.T) {
+	utils.InitLogger(true)
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(logFile, []byte("{\"level\":\"info\",\"time\":\"2025-01-01T00:00:00Z\"}\nplain\n"), 0644))
+
+	var mu sync.Mutex
+	var got []LogEvent
+	cfg := TailerConfig{
+		Files:         []string{logFile},
+		Parser:        &ParserRule{Type: ParserJSON},
+		Labels:        map[string]string{"service": "api"},
+		BufferCount:   2,
+		FlushInterval: 1,
+	}
+	tailer := NewTailer(cfg, func(events []LogEvent, _ []FilePosition) {
+		mu.Lock()
+		got = append(got, events...)
+		mu.Unlock()
+	})
+	require.NoError(t, tailer.Start())
+	defer tailer.Stop()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 2
+	}, 5*time.Second, 20*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "info", got[0].Fields["level"])
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), got[0].Time)
+	assert.Equal(t, "plain", got[1].Text)
+	assert.Nil(t, got[1].Fields)
+
+	for i, offset := range []int64{0, 47} {
+		assert.Equal(t, "default", got[i].Source)
+		assert.Equal(t, logFile, got[i].Path)
+		assert.Equal(t, offset, got[i].Offset)
+		assert.Equal(t, map[string]string{"service": "api"}, got[i].Labels)
+		assert.WithinDuration(t, time.Now(), got[i].ReadAt, 10*time.Second)
+	}
+}
@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactBuiltins(t *testing.T) {
+	r, err := NewRedactor([]RedactRule{
+		{Name: "bearer_token"},
+		{Name: "password"},
+		{Name: "card_number"},
+		{Name: "kr_rrn"},
+		{Name: "email"},
+	}, "")
+	require.NoError(t, err)
+
+	cases := map[string]string{
+		"Authorization: Bearer eyJhbGciOi.J9x-y_z": "Authorization: Bearer [REDACTED]",
+		`{"user":"bob","password":"hunter2"}`:      `{"user":"bob","password":"[REDACTED]"}`,
+		"login pwd: s3cr3t ok":                     "login pwd: [REDACTED] ok",
+		"paid with 4111-1111-1111-1111 today":      "paid with [REDACTED] today",
+		"order 1234567890123 shipped":              "order 1234567890123 shipped",
+		"rrn 900101-1234567 and 9001011234567":     "rrn [REDACTED] and [REDACTED]",
+		"contact kim.minsu+ops@example.co.kr":      "contact [REDACTED]",
+		"nothing to see":                           "nothing to see",
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, r.Redact(in), in)
+	}
+}
+
+func TestRedactCustomAndHash(t *testing.T) {
+	r, err := NewRedactor([]RedactRule{
+		{Name: "session", Pattern: `session=([0-9a-f]+)`, Action: RedactHash},
+		{Name: "ip", Pattern: `\d+\.\d+\.\d+\.\d+`},
+	}, "key")
+	require.NoError(t, err)
+
+	out := r.Redact("session=deadbeef from 10.0.0.1, session=deadbeef again")
+	assert.Regexp(t, `^session=\[session:[0-9a-f]{16}\] from \[REDACTED\], session=\[session:[0-9a-f]{16}\] again$`, out)
+	assert.Equal(t, out[8:34], out[len(out)-32:len(out)-6], "equal values hash alike")
+
+	other, err := NewRedactor([]RedactRule{{Name: "session", Pattern: `session=([0-9a-f]+)`, Action: RedactHash}}, "other")
+	require.NoError(t, err)
+	assert.NotEqual(t, out[8:34], other.Redact("session=deadbeef")[8:])
+
+	_, err = NewRedactor([]RedactRule{{Name: "ssn"}}, "")
+	assert.Error(t, err)
+	_, err = NewRedactor([]RedactRule{{Name: "x", Pattern: "("}}, "")
+	assert.Error(t, err)
+	_, err = NewRedactor([]RedactRule{{Name: "email", Action: "drop"}}, "")
+	assert.Error(t, err)
+}
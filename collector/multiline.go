@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	MatchAfter  = "after"
+	MatchBefore = "before"
+
+	defaultMultilineMaxLines = 500
+	defaultMultilineTimeout  = 5 * time.Second
+)
+
+// MultilineRule joins lines into one event. A line "matches" when Pattern
+// matches it, inverted by Negate. With Match "after" a matching line is
+// appended to the event before it, so a start pattern is written as
+// Negate: true and a continuation pattern (e.g. `^\s`) as Negate: false.
+// With Match "before" a matching line is joined with the line after it.
+// Events are cut after MaxLines lines, or when no line arrives within
+// Timeout.
+type MultilineRule struct {
+	Pattern  string
+	Negate   bool
+	Match    string
+	MaxLines int
+	Timeout  time.Duration
+}
+
+// multiline assembles the lines of one file into events.
+type multiline struct {
+	re       *regexp.Regexp
+	negate   bool
+	before   bool
+	maxLines int
+	timeout  time.Duration
+
+	lines []string
+	pos   FilePosition
+}
+
+func newMultiline(rule *MultilineRule) (*multiline, error) {
+	if rule == nil || rule.Pattern == "" {
+		return nil, nil
+	}
+
+	re, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	m := &multiline{
+		re:       re,
+		negate:   rule.Negate,
+		before:   rule.Match == MatchBefore,
+		maxLines: rule.MaxLines,
+		timeout:  rule.Timeout,
+	}
+	if m.maxLines <= 0 {
+		m.maxLines = defaultMultilineMaxLines
+	}
+	if m.timeout <= 0 {
+		m.timeout = defaultMultilineTimeout
+	}
+	return m, nil
+}
+
+// add feeds one line read up to pos and calls emit for every event it
+// completes.
+func (m *multiline) add(text string, pos FilePosition, emit func(string, FilePosition)) {
+	matched := m.re.MatchString(text) != m.negate
+
+	if !m.before && !matched && len(m.lines) > 0 {
+		m.flush(emit)
+	}
+
+	m.lines = append(m.lines, text)
+	m.pos = pos
+
+	if (m.before && !matched) || len(m.lines) >= m.maxLines {
+		m.flush(emit)
+	}
+}
+
+// flush emits the pending event, if any.
+func (m *multiline) flush(emit func(string, FilePosition)) {
+	if len(m.lines) == 0 {
+		return
+	}
+	emit(strings.Join(m.lines, "\n"), m.pos)
+	m.lines = nil
+}
+
+func (m *multiline) pending() bool {
+	return len(m.lines) > 0
+}
@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assemble(t *testing.T, rule MultilineRule, lines ...string) []string {
+	t.Helper()
+	ml, err := newMultiline(&rule)
+	require.NoError(t, err)
+
+	var events []string
+	emit := func(text string, _ FilePosition) { events = append(events, text) }
+	for _, line := range lines {
+		ml.add(line, FilePosition{}, emit)
+	}
+	ml.flush(emit)
+	return events
+}
+
+func TestMultilineStartPattern(t *testing.T) {
+	events := assemble(t, MultilineRule{Pattern: `^\d{4}-\d{2}-\d{2}`, Negate: true, Match: MatchAfter},
+		"2025-01-01 ERROR boom",
+		"java.lang.IllegalStateException: boom",
+		"\tat com.example.Main.run(Main.java:10)",
+		"2025-01-01 INFO next",
+	)
+	assert.Equal(t, []string{
+		"2025-01-01 ERROR boom\njava.lang.IllegalStateException: boom\n\tat com.example.Main.run(Main.java:10)",
+		"2025-01-01 INFO next",
+	}, events)
+}
+
+func TestMultilineContinuationPattern(t *testing.T) {
+	events := assemble(t, MultilineRule{Pattern: `^(\s|goroutine |panic:|$)`, Match: MatchAfter},
+		"panic: runtime error",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/app/main.go:5 +0x1d",
+	)
+	assert.Equal(t, []string{"panic: runtime error\n\ngoroutine 1 [running]:", "main.main()\n\t/app/main.go:5 +0x1d"}, events)
+}
+
+func TestMultilineBeforeAndMaxLines(t *testing.T) {
+	events := assemble(t, MultilineRule{Pattern: `\\$`, Match: MatchBefore},
+		`one \`,
+		`two \`,
+		`three`,
+		`four`,
+	)
+	assert.Equal(t, []string{"one \\\ntwo \\\nthree", "four"}, events)
+
+	events = assemble(t, MultilineRule{Pattern: `^\s`, Match: MatchAfter, MaxLines: 2},
+		"a", " 1", " 2", " 3",
+	)
+	assert.Equal(t, []string{"a\n 1", " 2\n 3"}, events)
+}
+
+func TestTailerFlushesMultilineOnTimeout(t *testing.T) {
+	utils.InitLogger(true)
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(logFile, []byte("ERROR boom\n  at frame1\n  at frame2\n"), 0644))
+
+	var mu sync.Mutex
+	var got []string
+	cfg := TailerConfig{
+		Files:         []string{logFile},
+		Multiline:     &MultilineRule{Pattern: `^\s`, Match: MatchAfter, Timeout: 100 * time.Millisecond},
+		BufferCount:   1,
+		FlushInterval: 1,
+	}
+	tailer := NewTailer(cfg, func(events []LogEvent, _ []FilePosition) {
+		mu.Lock()
+		for _, ev := range events {
+			got = append(got, ev.Text)
+		}
+		mu.Unlock()
+	})
+	require.NoError(t, tailer.Start())
+	defer tailer.Stop()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, "ERROR boom\n  at frame1\n  at frame2", got[0])
+	mu.Unlock()
+}
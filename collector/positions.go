@@ -0,0 +1,183 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"revnoa/utils"
+	"sort"
+	"sync"
+)
+
+// fingerprintSize is how many leading bytes of a file identify it.
+const fingerprintSize = 1024
+
+// FilePosition records how far a tailed file has been delivered. Device
+// and Inode hold the platform file ID (volume serial and file index on
+// Windows); Fingerprint is a hash of the first FingerprintSize bytes.
+// Journal sources store their cursor under "journal:<source>" instead.
+type FilePosition struct {
+	Path            string `json:"path"`
+	Device          uint64 `json:"device"`
+	Inode           uint64 `json:"inode"`
+	Offset          int64  `json:"offset"`
+	Fingerprint     string `json:"fingerprint"`
+	FingerprintSize int64  `json:"fingerprint_size"`
+	Cursor          string `json:"cursor,omitempty"`
+}
+
+func (p FilePosition) sameFile(o FilePosition) bool {
+	return p.Device == o.Device && p.Inode == o.Inode && p.Fingerprint == o.Fingerprint
+}
+
+// Positions is the registry of delivered offsets, persisted as JSON so
+// tailing resumes where it stopped after a restart.
+type Positions struct {
+	path string
+
+	mu    sync.Mutex
+	files map[string]FilePosition
+}
+
+type positionsFile struct {
+	Files []FilePosition `json:"files"`
+}
+
+// OpenPositions loads the registry at path. A missing file is an empty
+// registry; an unreadable one is logged and started over.
+func OpenPositions(path string) (*Positions, error) {
+	p := &Positions{path: path, files: map[string]FilePosition{}}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored positionsFile
+	if err := json.Unmarshal(data, &stored); err != nil {
+		utils.WarnLogger.Printf("Positions file %s is corrupt, starting over: %v", path, err)
+		return p, nil
+	}
+	for _, pos := range stored.Files {
+		p.files[pos.Path] = pos
+	}
+	return p, nil
+}
+
+// Resume returns the offset to start tailing path from. It is the stored
+// offset if the file is still the same one and has not shrunk below it,
+// and 0 after rotation or truncation. ok is false if nothing is stored.
+func (p *Positions) Resume(path string) (offset int64, ok bool) {
+	p.mu.Lock()
+	stored, ok := p.files[path]
+	p.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+
+	current, err := statPosition(path, stored.FingerprintSize)
+	if err != nil {
+		return 0, true
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		return 0, true
+	case !current.sameFile(stored):
+		utils.InfoLogger.Printf("%s was rotated or replaced, reading from the start", path)
+		return 0, true
+	case info.Size() < stored.Offset:
+		utils.InfoLogger.Printf("%s was truncated, reading from the start", path)
+		return 0, true
+	}
+	return stored.Offset, true
+}
+
+// Cursor returns the journal cursor stored under key.
+func (p *Positions) Cursor(key string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stored, ok := p.files[key]
+	return stored.Cursor, ok && stored.Cursor != ""
+}
+
+// Commit stores delivered positions and writes the registry. Positions of
+// the file already tracked only move forward; one of a file rotated or
+// truncated in place, with new leading bytes, replaces the old one.
+func (p *Positions) Commit(positions []FilePosition) error {
+	if len(positions) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, pos := range positions {
+		if old, ok := p.files[pos.Path]; ok && old.sameFile(pos) && old.Offset > pos.Offset {
+			continue
+		}
+		p.files[pos.Path] = pos
+	}
+	return p.save()
+}
+
+func (p *Positions) save() error {
+	stored := positionsFile{Files: make([]FilePosition, 0, len(p.files))}
+	for _, pos := range p.files {
+		stored.Files = append(stored.Files, pos)
+	}
+	sort.Slice(stored.Files, func(i, j int) bool { return stored.Files[i].Path < stored.Files[j].Path })
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// statPosition identifies the file at path by its file ID and the hash of
+// its first size bytes (or fingerprintSize bytes if size is 0).
+func statPosition(path string, size int64) (FilePosition, error) {
+	pos := FilePosition{Path: path}
+
+	dev, ino, err := fileIdentity(path)
+	if err != nil {
+		return pos, err
+	}
+	pos.Device, pos.Inode = dev, ino
+
+	f, err := os.Open(path)
+	if err != nil {
+		return pos, err
+	}
+	defer f.Close()
+
+	if size <= 0 {
+		size = fingerprintSize
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, io.LimitReader(f, size))
+	if err != nil {
+		return pos, err
+	}
+	pos.Fingerprint = hex.EncodeToString(h.Sum(nil))
+	pos.FingerprintSize = n
+	return pos, nil
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPositionsResume(t *testing.T) {
+	utils.InitLogger(true)
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(logFile, []byte("one\ntwo\n"), 0644))
+
+	positions, err := OpenPositions(filepath.Join(dir, "positions.json"))
+	require.NoError(t, err)
+
+	_, ok := positions.Resume(logFile)
+	assert.False(t, ok)
+
+	pos, err := statPosition(logFile, 0)
+	require.NoError(t, err)
+	pos.Offset = 4
+	require.NoError(t, positions.Commit([]FilePosition{pos}))
+
+	// Reopened from disk, the offset survives and appends keep it valid.
+	positions, err = OpenPositions(filepath.Join(dir, "positions.json"))
+	require.NoError(t, err)
+	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	f.WriteString("three\n")
+	f.Close()
+
+	offset, ok := positions.Resume(logFile)
+	assert.True(t, ok)
+	assert.Equal(t, int64(4), offset)
+
+	// An older position for the same file does not move it back.
+	pos.Offset = 2
+	require.NoError(t, positions.Commit([]FilePosition{pos}))
+	offset, _ = positions.Resume(logFile)
+	assert.Equal(t, int64(4), offset)
+
+	// After copytruncate the same inode holds new lines, whose smaller
+	// offsets replace the old one.
+	require.NoError(t, os.WriteFile(logFile, []byte("a\nnew\n"), 0644))
+	pos, err = statPosition(logFile, 0)
+	require.NoError(t, err)
+	pos.Offset = 2
+	require.NoError(t, positions.Commit([]FilePosition{pos}))
+	offset, _ = positions.Resume(logFile)
+	assert.Equal(t, int64(2), offset)
+}
+
+func TestPositionsDetectTruncationAndRotation(t *testing.T) {
+	utils.InitLogger(true)
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(logFile, []byte("first line\nsecond line\n"), 0644))
+
+	positions, err := OpenPositions(filepath.Join(dir, "positions.json"))
+	require.NoError(t, err)
+	pos, err := statPosition(logFile, 0)
+	require.NoError(t, err)
+	pos.Offset = 23
+	require.NoError(t, positions.Commit([]FilePosition{pos}))
+
+	require.NoError(t, os.Truncate(logFile, 0))
+	offset, _ := positions.Resume(logFile)
+	assert.Equal(t, int64(0), offset, "truncated")
+
+	require.NoError(t, os.WriteFile(logFile, []byte("first line\nsecond line\n"), 0644))
+	require.NoError(t, positions.Commit([]FilePosition{pos}))
+	require.NoError(t, os.Rename(logFile, logFile+".1"))
+	require.NoError(t, os.WriteFile(logFile, []byte("another file, much longer than before\n"), 0644))
+	offset, _ = positions.Resume(logFile)
+	assert.Equal(t, int64(0), offset, "rotated")
+}
+
+func TestTailerResumesFromCommittedOffset(t *testing.T) {
+	utils.InitLogger(true)
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(logFile, []byte("one\ntwo\n"), 0644))
+
+	positions, err := OpenPositions(filepath.Join(dir, "positions.json"))
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var got []string
+	run := func(want int) {
+		cfg := TailerConfig{Files: []string{logFile}, BufferCount: 1, FlushInterval: 1, Positions: positions}
+		tailer := NewTailer(cfg, func(events []LogEvent, offsets []FilePosition) {
+			mu.Lock()
+			for _, ev := range events {
+				got = append(got, ev.Text)
+			}
+			mu.Unlock()
+			require.NoError(t, positions.Commit(offsets))
+		})
+		require.NoError(t, tailer.Start())
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(got) >= want
+		}, 5*time.Second, 10*time.Millisecond)
+		tailer.Stop()
+	}
+
+	run(2)
+
+	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	f.WriteString("three\n")
+	f.Close()
+
+	run(3)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"one", "two", "three"}, got)
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func fileIdentity(path string) (dev, ino uint64, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, fmt.Errorf("no inode for %s", path)
+	}
+	return uint64(st.Dev), uint64(st.Ino), nil
+}
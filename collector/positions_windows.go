@@ -0,0 +1,30 @@
+//go:build windows
+// +build windows
+
+package collector
+
+import (
+	"syscall"
+)
+
+// fileIdentity returns the volume serial number and file index, which
+// stay the same across renames like an inode does.
+func fileIdentity(path string) (dev, ino uint64, err error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	h, err := syscall.CreateFile(name, 0,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer syscall.CloseHandle(h)
+
+	var info syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(h, &info); err != nil {
+		return 0, 0, err
+	}
+	return uint64(info.VolumeSerialNumber), uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow), nil
+}
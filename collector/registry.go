@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"revnoa/config"
+	"sync"
+	"time"
+)
+
+// Collector is a single metrics source. Built-in collectors register
+// themselves from init, so the push loop and the /metrics handler only
+// ever loop over the registry.
+type Collector interface {
+	Name() string
+	Options(cfg *config.Config) config.CollectorOptions
+	Collect(ctx context.Context) (Result, error)
+}
+
+// Result is the typed output of a collector. It knows which part of
+// FullMetrics it fills in.
+type Result interface {
+	Apply(m *FullMetrics)
+}
+
+// Factory builds a collector from the loaded config.
+type Factory func(cfg *config.Config) Collector
+
+type registration struct {
+	name    string
+	factory Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []registration
+)
+
+// Register adds a collector factory. Collectors are run and reported in
+// registration order. Registering the same name twice panics.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, r := range registry {
+		if r.name == name {
+			panic(fmt.Sprintf("collector %q registered twice", name))
+		}
+	}
+	registry = append(registry, registration{name: name, factory: factory})
+}
+
+// RegisterFunc registers a collector that needs no state of its own.
+func RegisterFunc[T any](name string, options func(cfg *config.Config) config.CollectorOptions, collect func(ctx context.Context) (T, error), apply func(m *FullMetrics, v T)) {
+	Register(name, func(cfg *config.Config) Collector {
+		return NewFuncCollector(name, options, collect, apply)
+	})
+}
+
+// Registered returns the names of all registered collectors.
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for _, r := range registry {
+		names = append(names, r.name)
+	}
+	return names
+}
+
+// EnabledCollectors builds every registered collector that is enabled in cfg.
+func EnabledCollectors(cfg *config.Config) []Collector {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var result []Collector
+	for _, r := range registry {
+		c := r.factory(cfg)
+		if c.Options(cfg).Enabled {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// ErrCollectTimeout is reported for a collector that missed its deadline.
+var ErrCollectTimeout = errors.New("timed out")
+
+// RunCollector runs c under its own deadline. A collector that ignores ctx
+// is abandoned once the deadline passes so it cannot stall the caller.
+func RunCollector(ctx context.Context, c Collector, timeout time.Duration) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type outcome struct {
+		res Result
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := c.Collect(ctx)
+		done <- outcome{res: res, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		if o.err != nil && errors.Is(o.err, context.DeadlineExceeded) {
+			return nil, ErrCollectTimeout
+		}
+		return o.res, o.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrCollectTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+type funcCollector[T any] struct {
+	name    string
+	options func(cfg *config.Config) config.CollectorOptions
+	collect func(ctx context.Context) (T, error)
+	apply   func(m *FullMetrics, v T)
+}
+
+// NewFuncCollector wraps plain functions into a Collector.
+func NewFuncCollector[T any](name string, options func(cfg *config.Config) config.CollectorOptions, collect func(ctx context.Context) (T, error), apply func(m *FullMetrics, v T)) Collector {
+	return &funcCollector[T]{name: name, options: options, collect: collect, apply: apply}
+}
+
+func (f *funcCollector[T]) Name() string {
+	return f.name
+}
+
+func (f *funcCollector[T]) Options(cfg *config.Config) config.CollectorOptions {
+	return f.options(cfg)
+}
+
+func (f *funcCollector[T]) Collect(ctx context.Context) (Result, error) {
+	v, err := f.collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return valueResult[T]{value: v, apply: f.apply}, nil
+}
+
+type valueResult[T any] struct {
+	value T
+	apply func(m *FullMetrics, v T)
+}
+
+func (r valueResult[T]) Apply(m *FullMetrics) {
+	r.apply(m, r.value)
+}
@@ -0,0 +1,45 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"revnoa/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnabledCollectorsFollowsConfig(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Collectors.CPU.Enabled = true
+	cfg.Collectors.Disk.Enabled = true
+
+	var names []string
+	for _, c := range EnabledCollectors(cfg) {
+		names = append(names, c.Name())
+	}
+	assert.Equal(t, []string{"cpu", "disk"}, names)
+}
+
+func TestRegisteredIncludesBuiltins(t *testing.T) {
+	names := Registered()
+	for _, name := range []string{"cpu", "mem", "disk", "net", "ports", "host", "docker", "redis"} {
+		assert.Contains(t, names, name)
+	}
+}
+
+func TestRunCollectorTimesOut(t *testing.T) {
+	always := func(cfg *config.Config) config.CollectorOptions { return config.CollectorOptions{Enabled: true} }
+	hung := NewFuncCollector("disk", always,
+		func(ctx context.Context) ([]DiskUsage, error) {
+			time.Sleep(time.Second)
+			return nil, nil
+		},
+		func(m *FullMetrics, v []DiskUsage) { m.Disks = v })
+
+	start := time.Now()
+	_, err := RunCollector(context.Background(), hung, 20*time.Millisecond)
+	assert.ErrorIs(t, err, ErrCollectTimeout)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
@@ -0,0 +1,288 @@
+package collector
+
+import (
+	"context"
+	"math/rand"
+	"revnoa/config"
+	"revnoa/utils"
+	"sync"
+	"time"
+)
+
+// Sample is the latest outcome of one collector run.
+type Sample struct {
+	Result      Result
+	Err         error
+	CollectedAt time.Time
+	AttemptedAt time.Time
+}
+
+// DefaultCollectTimeout bounds a collector run when no timeout is configured.
+const DefaultCollectTimeout = 5 * time.Second
+
+type scheduledCollector struct {
+	collector Collector
+	interval  time.Duration
+	timeout   time.Duration
+}
+
+// Scheduler runs every collector on its own interval and keeps the most
+// recent result of each, so a push can be assembled without collecting.
+type Scheduler struct {
+	entries   []scheduledCollector
+	maxJitter time.Duration
+
+	mu      sync.RWMutex
+	latest  map[string]Sample
+	running bool
+
+	refreshMu sync.Mutex
+	inflight  chan struct{}
+
+	wg sync.WaitGroup
+}
+
+// NewScheduler prepares collectors for scheduling. A collector without its
+// own interval runs on the global one, which also caps the startup jitter.
+func NewScheduler(cfg *config.Config, collectors []Collector) *Scheduler {
+	global := time.Duration(cfg.Interval) * time.Second
+
+	s := &Scheduler{
+		maxJitter: global,
+		latest:    make(map[string]Sample),
+	}
+	for _, c := range collectors {
+		opts := c.Options(cfg)
+
+		interval := global
+		if opts.Interval > 0 {
+			interval = time.Duration(opts.Interval) * time.Second
+		}
+		timeout := DefaultCollectTimeout
+		if opts.Timeout > 0 {
+			timeout = time.Duration(opts.Timeout) * time.Second
+		}
+		s.entries = append(s.entries, scheduledCollector{collector: c, interval: interval, timeout: timeout})
+	}
+	return s
+}
+
+// Start launches one goroutine per collector. They stop when ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.running = true
+	s.mu.Unlock()
+
+	for _, e := range s.entries {
+		e := e
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.run(ctx, e)
+		}()
+	}
+}
+
+// Wait blocks until every collector goroutine has returned.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) run(ctx context.Context, e scheduledCollector) {
+	jitter := e.interval
+	if s.maxJitter > 0 && s.maxJitter < jitter {
+		jitter = s.maxJitter
+	}
+
+	delay := time.Duration(0)
+	if jitter > 0 {
+		delay = time.Duration(rand.Int63n(int64(jitter)))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			s.collect(ctx, e)
+			timer.Reset(e.interval)
+		}
+	}
+}
+
+func (s *Scheduler) collect(ctx context.Context, e scheduledCollector) {
+	name := e.collector.Name()
+
+	res, err := RunCollector(ctx, e.collector, e.timeout)
+	if err == ErrCollectTimeout {
+		utils.WarnLogger.Printf("Collector %s timed out after %v", name, e.timeout)
+	} else if err != nil {
+		utils.ErrorLogger.Printf("Couldn't collect %s: %v", name, err)
+	}
+	s.store(name, res, err)
+}
+
+// CollectNow runs every collector in parallel, each under its own timeout,
+// and returns the resulting snapshot.
+func (s *Scheduler) CollectNow(ctx context.Context, agentID string) FullMetrics {
+	s.collectEntries(ctx, s.entries)
+	return s.Snapshot(agentID)
+}
+
+// Selection narrows a snapshot to some collectors. An empty Include
+// selects every enabled collector.
+type Selection struct {
+	Include []string
+	Exclude []string
+}
+
+func (sel Selection) requested(name string) bool {
+	if len(sel.Include) > 0 && !containsName(sel.Include, name) {
+		return false
+	}
+	return !containsName(sel.Exclude, name)
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Fresh returns a snapshot of the selected collectors in which no value is
+// older than maxAge. Only stale collectors are run again, and concurrent
+// callers share a single in-flight refresh. While the scheduler is running,
+// a collector is not considered stale before its own interval has passed.
+func (s *Scheduler) Fresh(ctx context.Context, agentID string, maxAge time.Duration, sel Selection) FullMetrics {
+	for {
+		stale := s.staleEntries(maxAge, sel)
+		if len(stale) == 0 {
+			break
+		}
+
+		s.refreshMu.Lock()
+		if wait := s.inflight; wait != nil {
+			s.refreshMu.Unlock()
+			select {
+			case <-wait:
+				// The shared refresh may have covered other collectors; check again.
+				continue
+			case <-ctx.Done():
+				return s.SnapshotOf(agentID, sel)
+			}
+		}
+		done := make(chan struct{})
+		s.inflight = done
+		s.refreshMu.Unlock()
+
+		// The refresh is shared, so it must not die with one caller's request.
+		s.collectEntries(context.Background(), stale)
+
+		s.refreshMu.Lock()
+		s.inflight = nil
+		close(done)
+		s.refreshMu.Unlock()
+		break
+	}
+	return s.SnapshotOf(agentID, sel)
+}
+
+func (s *Scheduler) staleEntries(maxAge time.Duration, sel Selection) []scheduledCollector {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var stale []scheduledCollector
+	for _, e := range s.entries {
+		if !sel.requested(e.collector.Name()) {
+			continue
+		}
+		limit := maxAge
+		if s.running && e.interval > limit {
+			limit = e.interval
+		}
+		sample, ok := s.latest[e.collector.Name()]
+		if !ok || now.Sub(sample.AttemptedAt) >= limit {
+			stale = append(stale, e)
+		}
+	}
+	return stale
+}
+
+func (s *Scheduler) collectEntries(ctx context.Context, entries []scheduledCollector) {
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		e := e
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.collect(ctx, e)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) store(name string, res Result, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sample := s.latest[name]
+	sample.Err = err
+	sample.AttemptedAt = time.Now()
+	if err == nil {
+		sample.Result = res
+		sample.CollectedAt = time.Now()
+	}
+	s.latest[name] = sample
+}
+
+// Snapshot assembles the most recent value from every collector.
+// A collector that has not produced a value yet is left out, and one whose
+// last run failed is listed under Errors.
+func (s *Scheduler) Snapshot(agentID string) FullMetrics {
+	return s.SnapshotOf(agentID, Selection{})
+}
+
+// SnapshotOf is Snapshot limited to the selected collectors. Requested
+// collectors that are unknown, disabled or without a value are listed
+// under Unavailable.
+func (s *Scheduler) SnapshotOf(agentID string, sel Selection) FullMetrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	payload := FullMetrics{AgentID: agentID, Timestamp: time.Now().Unix()}
+	known := make(map[string]bool, len(s.entries))
+	for _, e := range s.entries {
+		name := e.collector.Name()
+		known[name] = true
+		if !sel.requested(name) {
+			continue
+		}
+
+		sample, ok := s.latest[name]
+		if !ok || sample.Result == nil {
+			payload.Unavailable = append(payload.Unavailable, name)
+		} else {
+			sample.Result.Apply(&payload)
+		}
+		if ok && sample.Err != nil {
+			if payload.Errors == nil {
+				payload.Errors = make(map[string]string)
+			}
+			payload.Errors[name] = sample.Err.Error()
+		}
+	}
+
+	for _, name := range sel.Include {
+		if !known[name] && !containsName(sel.Exclude, name) {
+			payload.Unavailable = append(payload.Unavailable, name)
+		}
+	}
+	return payload
+}
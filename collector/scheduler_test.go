@@ -0,0 +1,165 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"revnoa/config"
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulerUsesPerCollectorInterval(t *testing.T) {
+	cfg := &config.Config{Interval: 10}
+	options := func(interval int) func(cfg *config.Config) config.CollectorOptions {
+		return func(cfg *config.Config) config.CollectorOptions {
+			return config.CollectorOptions{Enabled: true, Interval: interval}
+		}
+	}
+
+	s := NewScheduler(cfg, []Collector{
+		NewFuncCollector[*CPUStats]("cpu", options(0), nil, nil),
+		NewFuncCollector[*HostInfo]("host", options(3600), nil, nil),
+	})
+
+	assert.Equal(t, 10*time.Second, s.entries[0].interval)
+	assert.Equal(t, time.Hour, s.entries[1].interval)
+}
+
+func TestSchedulerSnapshotKeepsLatestValues(t *testing.T) {
+	utils.InitLogger(true)
+
+	var fastRuns, slowRuns int32
+	always := func(cfg *config.Config) config.CollectorOptions { return config.CollectorOptions{Enabled: true} }
+	fast := NewFuncCollector("cpu", always,
+		func(ctx context.Context) (*CPUStats, error) {
+			n := atomic.AddInt32(&fastRuns, 1)
+			return &CPUStats{Cores: int(n)}, nil
+		},
+		func(m *FullMetrics, v *CPUStats) { m.Cpu = v })
+	slow := NewFuncCollector("host", always,
+		func(ctx context.Context) (*HostInfo, error) {
+			atomic.AddInt32(&slowRuns, 1)
+			return &HostInfo{Hostname: "test"}, nil
+		},
+		func(m *FullMetrics, v *HostInfo) { m.Host = v })
+
+	s := NewScheduler(&config.Config{Interval: 1}, []Collector{fast, slow})
+	s.maxJitter = 5 * time.Millisecond
+	s.entries[0].interval = 10 * time.Millisecond
+	s.entries[1].interval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	s.Wait()
+
+	assert.Greater(t, atomic.LoadInt32(&fastRuns), int32(3))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slowRuns))
+
+	payload := s.Snapshot("agent-1")
+	assert.Equal(t, int(atomic.LoadInt32(&fastRuns)), payload.Cpu.Cores)
+	assert.Equal(t, "test", payload.Host.Hostname)
+}
+
+func TestSchedulerCollectNowReportsTimeouts(t *testing.T) {
+	utils.InitLogger(true)
+
+	always := func(cfg *config.Config) config.CollectorOptions { return config.CollectorOptions{Enabled: true} }
+	s := NewScheduler(&config.Config{Interval: 10}, []Collector{
+		NewFuncCollector("host", always,
+			func(ctx context.Context) (*HostInfo, error) { return &HostInfo{Hostname: "test"}, nil },
+			func(m *FullMetrics, v *HostInfo) { m.Host = v }),
+		NewFuncCollector("mem", always,
+			func(ctx context.Context) (*MemoryStats, error) { return nil, errors.New("boom") },
+			func(m *FullMetrics, v *MemoryStats) { m.Memory = v }),
+		NewFuncCollector("docker", always,
+			func(ctx context.Context) ([]DockerContainerInfo, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+			func(m *FullMetrics, v []DockerContainerInfo) { m.Docker = v }),
+	})
+	s.entries[2].timeout = 20 * time.Millisecond
+
+	payload := s.CollectNow(context.Background(), "agent-1")
+	assert.Equal(t, "agent-1", payload.AgentID)
+	assert.Equal(t, "test", payload.Host.Hostname)
+	assert.Nil(t, payload.Memory)
+	assert.Equal(t, "boom", payload.Errors["mem"])
+	assert.Equal(t, ErrCollectTimeout.Error(), payload.Errors["docker"])
+	assert.NotContains(t, payload.Errors, "host")
+}
+
+func TestSchedulerFreshSharesOneRefresh(t *testing.T) {
+	utils.InitLogger(true)
+
+	var runs int32
+	always := func(cfg *config.Config) config.CollectorOptions { return config.CollectorOptions{Enabled: true} }
+	s := NewScheduler(&config.Config{Interval: 10}, []Collector{
+		NewFuncCollector("cpu", always,
+			func(ctx context.Context) (*CPUStats, error) {
+				atomic.AddInt32(&runs, 1)
+				time.Sleep(50 * time.Millisecond)
+				return &CPUStats{Cores: 2}, nil
+			},
+			func(m *FullMetrics, v *CPUStats) { m.Cpu = v }),
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payload := s.Fresh(context.Background(), "agent-1", time.Minute, Selection{})
+			assert.NotNil(t, payload.Cpu)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+
+	s.Fresh(context.Background(), "agent-1", time.Minute, Selection{})
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs), "fresh snapshot must be served from cache")
+
+	time.Sleep(5 * time.Millisecond)
+	s.Fresh(context.Background(), "agent-1", time.Millisecond, Selection{})
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs), "stale snapshot must trigger a refresh")
+}
+
+func TestSchedulerFreshSelection(t *testing.T) {
+	utils.InitLogger(true)
+
+	var portRuns int32
+	always := func(cfg *config.Config) config.CollectorOptions { return config.CollectorOptions{Enabled: true} }
+	s := NewScheduler(&config.Config{Interval: 10}, []Collector{
+		NewFuncCollector("cpu", always,
+			func(ctx context.Context) (*CPUStats, error) { return &CPUStats{Cores: 2}, nil },
+			func(m *FullMetrics, v *CPUStats) { m.Cpu = v }),
+		NewFuncCollector("mem", always,
+			func(ctx context.Context) (*MemoryStats, error) { return nil, errors.New("boom") },
+			func(m *FullMetrics, v *MemoryStats) { m.Memory = v }),
+		NewFuncCollector("ports", always,
+			func(ctx context.Context) ([]PortInfo, error) {
+				atomic.AddInt32(&portRuns, 1)
+				return []PortInfo{{Port: "22"}}, nil
+			},
+			func(m *FullMetrics, v []PortInfo) { m.Ports = v }),
+	})
+
+	payload := s.Fresh(context.Background(), "agent-1", time.Minute, Selection{Include: []string{"cpu", "mem", "redis"}})
+	assert.NotNil(t, payload.Cpu)
+	assert.Nil(t, payload.Ports)
+	assert.ElementsMatch(t, []string{"mem", "redis"}, payload.Unavailable)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&portRuns), "unselected collectors must not run")
+
+	payload = s.Fresh(context.Background(), "agent-1", time.Minute, Selection{Exclude: []string{"ports"}})
+	assert.NotNil(t, payload.Cpu)
+	assert.Nil(t, payload.Ports)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&portRuns))
+}
@@ -0,0 +1,249 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var severityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// SyslogMessage is a parsed RFC 3164 or RFC 5424 message. Facility and
+// Severity are -1 when the message has no PRI part, as in files written
+// by a local syslog daemon. Version is 1 for RFC 5424 and 0 otherwise.
+type SyslogMessage struct {
+	Facility       int
+	Severity       int
+	Version        int
+	Timestamp      time.Time
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData string
+	Message        string
+}
+
+// Fields returns the message as parser fields.
+func (m SyslogMessage) Fields() map[string]any {
+	fields := map[string]any{"message": m.Message}
+	if m.Severity >= 0 {
+		fields["facility"] = m.Facility
+		fields["severity"] = m.Severity
+		fields["level"] = severityNames[m.Severity]
+	}
+	if !m.Timestamp.IsZero() {
+		fields["time"] = m.Timestamp
+	}
+	for key, value := range map[string]string{
+		"hostname":        m.Hostname,
+		"app_name":        m.AppName,
+		"proc_id":         m.ProcID,
+		"msg_id":          m.MsgID,
+		"structured_data": m.StructuredData,
+	} {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+	if params := m.Params(); len(params) > 0 {
+		fields["sd"] = params
+	}
+	return fields
+}
+
+// Params returns the parameters of each STRUCTURED-DATA element by its
+// SD-ID, with escaped characters in the values unescaped.
+func (m SyslogMessage) Params() map[string]map[string]string {
+	sd := m.StructuredData
+	var params map[string]map[string]string
+	for strings.HasPrefix(sd, "[") {
+		sd = sd[1:]
+		end := strings.IndexAny(sd, " ]")
+		if end < 0 {
+			break
+		}
+		element := map[string]string{}
+		if params == nil {
+			params = map[string]map[string]string{}
+		}
+		params[sd[:end]] = element
+		sd = sd[end:]
+
+		// Each parameter is ` name="value"` until the closing "]".
+		for strings.HasPrefix(sd, " ") {
+			eq := strings.Index(sd, `="`)
+			if eq < 0 {
+				return params
+			}
+			name := sd[1:eq]
+			sd = sd[eq+2:]
+			var value strings.Builder
+			for len(sd) > 0 && sd[0] != '"' {
+				if sd[0] == '\\' && len(sd) > 1 && strings.IndexByte(`"\]`, sd[1]) >= 0 {
+					sd = sd[1:]
+				}
+				value.WriteByte(sd[0])
+				sd = sd[1:]
+			}
+			element[name] = value.String()
+			sd = strings.TrimPrefix(sd, `"`)
+		}
+		sd = strings.TrimPrefix(sd, "]")
+	}
+	return params
+}
+
+var errSyslogFormat = errors.New("not a syslog message")
+
+// ParseSyslog parses one syslog message. RFC 3164 timestamps carry no
+// year or zone; they are read in loc and in the current year, or the
+// previous one if that would put them more than a day in the future.
+func ParseSyslog(data []byte, loc *time.Location) (SyslogMessage, error) {
+	msg := SyslogMessage{Facility: -1, Severity: -1}
+	rest := data
+
+	if len(rest) > 0 && rest[0] == '<' {
+		end := bytes.IndexByte(rest, '>')
+		if end < 2 || end > 4 {
+			return msg, errSyslogFormat
+		}
+		pri, err := strconv.Atoi(string(rest[1:end]))
+		if err != nil || pri > 191 {
+			return msg, errSyslogFormat
+		}
+		msg.Facility, msg.Severity = pri/8, pri%8
+		rest = rest[end+1:]
+
+		if len(rest) > 1 && rest[0] == '1' && rest[1] == ' ' {
+			return parseRFC5424(msg, rest[2:])
+		}
+	}
+	return parseRFC3164(msg, string(rest), loc)
+}
+
+func parseRFC5424(msg SyslogMessage, rest []byte) (SyslogMessage, error) {
+	msg.Version = 1
+
+	var header [5]string
+	for i := range header {
+		sp := bytes.IndexByte(rest, ' ')
+		if sp < 0 {
+			return msg, errSyslogFormat
+		}
+		header[i] = nilValue(string(rest[:sp]))
+		rest = rest[sp+1:]
+	}
+
+	if header[0] != "" {
+		t, err := time.Parse(time.RFC3339Nano, header[0])
+		if err != nil {
+			return msg, errSyslogFormat
+		}
+		msg.Timestamp = t
+	}
+	msg.Hostname, msg.AppName, msg.ProcID, msg.MsgID = header[1], header[2], header[3], header[4]
+
+	sd, rest, err := splitStructuredData(rest)
+	if err != nil {
+		return msg, err
+	}
+	msg.StructuredData = nilValue(sd)
+
+	rest = bytes.TrimPrefix(rest, []byte(" "))
+	rest = bytes.TrimPrefix(rest, []byte("\xef\xbb\xbf"))
+	msg.Message = string(rest)
+	return msg, nil
+}
+
+// splitStructuredData cuts the STRUCTURED-DATA field off the front of
+// rest: either "-" or one or more [...] elements, where "]" may be
+// escaped inside quoted values.
+func splitStructuredData(rest []byte) (string, []byte, error) {
+	if len(rest) > 0 && rest[0] == '-' {
+		return "-", rest[1:], nil
+	}
+
+	i := 0
+	for i < len(rest) && rest[i] == '[' {
+		inQuote := false
+		for i++; i < len(rest); i++ {
+			c := rest[i]
+			if c == '\\' && inQuote {
+				i++
+				continue
+			}
+			if c == '"' {
+				inQuote = !inQuote
+			}
+			if c == ']' && !inQuote {
+				break
+			}
+		}
+		if i >= len(rest) {
+			return "", nil, errSyslogFormat
+		}
+		i++
+	}
+	if i == 0 {
+		return "", nil, errSyslogFormat
+	}
+	return string(rest[:i]), rest[i:], nil
+}
+
+func parseRFC3164(msg SyslogMessage, rest string, loc *time.Location) (SyslogMessage, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+
+	// High precision daemons write an RFC 3339 timestamp instead.
+	if sp := strings.IndexByte(rest, ' '); sp > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, rest[:sp]); err == nil {
+			msg.Timestamp = t
+			rest = rest[sp+1:]
+		}
+	}
+	if msg.Timestamp.IsZero() {
+		if len(rest) < len(time.Stamp) {
+			return msg, errSyslogFormat
+		}
+		t, err := time.ParseInLocation(time.Stamp, rest[:len(time.Stamp)], loc)
+		if err != nil {
+			return msg, errSyslogFormat
+		}
+		now := time.Now().In(loc)
+		t = t.AddDate(now.Year(), 0, 0)
+		if t.After(now.Add(24 * time.Hour)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		msg.Timestamp = t
+		rest = strings.TrimPrefix(rest[len(time.Stamp):], " ")
+	}
+
+	if sp := strings.IndexByte(rest, ' '); sp > 0 {
+		msg.Hostname = rest[:sp]
+		rest = rest[sp+1:]
+	}
+
+	// TAG is "app[pid]:" or "app:"; anything else is part of the message.
+	if colon := strings.Index(rest, ": "); colon > 0 && !strings.ContainsAny(rest[:colon], " ") {
+		tag := rest[:colon]
+		if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+			msg.AppName, msg.ProcID = tag[:open], tag[open+1:len(tag)-1]
+		} else {
+			msg.AppName = tag
+		}
+		rest = rest[colon+2:]
+	}
+	msg.Message = rest
+	return msg, nil
+}
+
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
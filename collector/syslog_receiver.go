@@ -0,0 +1,382 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"revnoa/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyslogRule makes a source receive syslog messages instead of reading
+// files. UDP and TCP are listen addresses such as ":514"; Unix is the
+// path of a datagram socket, like /dev/log. Empty ones are not opened.
+type SyslogRule struct {
+	UDP  string
+	TCP  string
+	Unix string
+}
+
+const (
+	// syslogMaxMessage bounds one received message; longer TCP frames
+	// close the connection and longer datagrams are truncated.
+	syslogMaxMessage = 64 * 1024
+	// syslogMaxLength bounds the digits of an octet count.
+	syslogMaxLength = 10
+)
+
+var errSyslogFrame = errors.New("malformed syslog frame")
+
+// syslogPacket is one received message and the address it came from.
+type syslogPacket struct {
+	data   []byte
+	remote string
+}
+
+// syslogReceiver listens on the addresses of a source and turns what it
+// receives into events. Messages of all listeners go through one channel
+// to a single goroutine, which owns the source's dedup state. The channel
+// is closed once every reader has stopped, so messages received before
+// a stop are still sent: unlike files, they can't be read again.
+type syslogReceiver struct {
+	src    LogSource
+	parser *eventParser
+	stages sourceStages
+
+	readers sync.WaitGroup
+	packets chan syslogPacket
+	conns   []net.PacketConn
+	ln      net.Listener
+	// socket is the Unix socket this receiver created, removed on stop.
+	socket string
+}
+
+// listenSyslog opens the listeners of src. If one can't be opened, those
+// already open are closed again.
+func listenSyslog(src LogSource, stages sourceStages) (*syslogReceiver, error) {
+	parser, err := newEventParser(src.Parser)
+	if err != nil {
+		utils.ErrorLogger.Printf("Invalid parser for %s, sending raw messages: %v", src.Name, err)
+	}
+	r := &syslogReceiver{
+		src:     src,
+		parser:  parser,
+		stages:  stages,
+		packets: make(chan syslogPacket, eventQueueSize),
+	}
+
+	rule := src.Syslog
+	if rule.UDP != "" {
+		conn, err := net.ListenPacket("udp", rule.UDP)
+		if err != nil {
+			r.close()
+			return nil, fmt.Errorf("syslog source %s: %w", src.Name, err)
+		}
+		r.conns = append(r.conns, conn)
+	}
+	if rule.Unix != "" {
+		if err := removeStaleSocket(rule.Unix); err != nil {
+			r.close()
+			return nil, fmt.Errorf("syslog source %s: %w", src.Name, err)
+		}
+		conn, err := net.ListenPacket("unixgram", rule.Unix)
+		if err != nil {
+			r.close()
+			return nil, fmt.Errorf("syslog source %s: %w", src.Name, err)
+		}
+		r.conns = append(r.conns, conn)
+		r.socket = rule.Unix
+	}
+	if rule.TCP != "" {
+		ln, err := net.Listen("tcp", rule.TCP)
+		if err != nil {
+			r.close()
+			return nil, fmt.Errorf("syslog source %s: %w", src.Name, err)
+		}
+		r.ln = ln
+	}
+	return r, nil
+}
+
+// removeStaleSocket removes a socket left behind at path by an earlier
+// run, which would fail the bind. A socket something still listens on,
+// such as the system logger's /dev/log, is left alone.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	for _, network := range []string{"unixgram", "unix"} {
+		if conn, err := net.Dial(network, path); err == nil {
+			conn.Close()
+			return fmt.Errorf("listen unixgram %s: address in use", path)
+		}
+	}
+	return os.Remove(path)
+}
+
+func (r *syslogReceiver) close() {
+	for _, conn := range r.conns {
+		conn.Close()
+	}
+	if r.ln != nil {
+		r.ln.Close()
+	}
+}
+
+// stop closes the listeners and removes the Unix socket it created.
+func (r *syslogReceiver) stop() {
+	r.close()
+	if r.socket != "" {
+		os.Remove(r.socket)
+	}
+}
+
+// start serves the listeners until ctx is done, sending events to out.
+// Every goroutine it starts is tracked by wg.
+func (r *syslogReceiver) start(ctx context.Context, wg *sync.WaitGroup, out chan<- tailedEvent) {
+	utils.InfoLogger.Printf("Receiving syslog for %s", r.src.Name)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		r.stop()
+	}()
+
+	for _, conn := range r.conns {
+		r.readers.Add(1)
+		go func() {
+			defer r.readers.Done()
+			r.readPackets(ctx, conn)
+		}()
+	}
+	if r.ln != nil {
+		r.readers.Add(1)
+		go func() {
+			defer r.readers.Done()
+			r.accept(ctx)
+		}()
+	}
+	go func() {
+		r.readers.Wait()
+		close(r.packets)
+	}()
+
+	// The tailer reads out until every source has stopped, so the sink
+	// doesn't give up on events once ctx is done.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.process(newSink(context.Background(), r.src, r.stages, out))
+	}()
+}
+
+// readPackets receives one message per datagram.
+func (r *syslogReceiver) readPackets(ctx context.Context, conn net.PacketConn) {
+	buf := make([]byte, syslogMaxMessage)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				utils.WarnLogger.Printf("Syslog receive failed for %s: %v", r.src.Name, err)
+				continue
+			}
+			return
+		}
+		r.packets <- syslogPacket{data: append([]byte(nil), buf[:n]...), remote: remoteAddr(addr)}
+	}
+}
+
+// remoteAddr names the sender of a datagram; senders on a Unix socket
+// usually have no address.
+func remoteAddr(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	if s := addr.String(); s != "<nil>" {
+		return s
+	}
+	return ""
+}
+
+// accept serves each TCP connection in its own goroutine.
+func (r *syslogReceiver) accept(ctx context.Context) {
+	for {
+		conn, err := r.ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				utils.WarnLogger.Printf("Syslog accept failed for %s: %v", r.src.Name, err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return
+		}
+
+		r.readers.Add(1)
+		go func() {
+			defer r.readers.Done()
+			stop := context.AfterFunc(ctx, func() { conn.Close() })
+			defer stop()
+			defer conn.Close()
+			r.readStream(ctx, conn)
+		}()
+	}
+}
+
+// readStream receives the messages of one TCP connection until it is
+// closed or sends a frame that can't be read.
+func (r *syslogReceiver) readStream(ctx context.Context, conn net.Conn) {
+	remote := conn.RemoteAddr().String()
+	reader := bufio.NewReaderSize(conn, syslogMaxMessage)
+	for {
+		data, err := readSyslogFrame(reader)
+		if len(data) > 0 {
+			r.packets <- syslogPacket{data: data, remote: remote}
+		}
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				utils.WarnLogger.Printf("Closing syslog connection from %s: %v", remote, err)
+			}
+			return
+		}
+	}
+}
+
+// readSyslogFrame reads the next message of a stream. A message starting
+// with a digit is octet counted (RFC 6587 "LEN SP MSG"); otherwise it
+// ends at a newline. A message cut short by the end of the stream is
+// returned along with the error.
+func readSyslogFrame(r *bufio.Reader) ([]byte, error) {
+	for {
+		first, err := r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+
+		if first[0] >= '1' && first[0] <= '9' {
+			var length strings.Builder
+			for {
+				c, err := r.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				if c == ' ' {
+					break
+				}
+				if c < '0' || c > '9' || length.Len() == syslogMaxLength {
+					return nil, errSyslogFrame
+				}
+				length.WriteByte(c)
+			}
+			n, err := strconv.Atoi(length.String())
+			if err != nil || n > syslogMaxMessage {
+				return nil, fmt.Errorf("%w: %s byte message", errSyslogFrame, length.String())
+			}
+			data := make([]byte, n)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, err
+			}
+			return data, nil
+		}
+
+		line, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, fmt.Errorf("%w: message over %d bytes", errSyslogFrame, syslogMaxMessage)
+		}
+		data := append([]byte(nil), trimSyslog(line)...)
+		if len(data) > 0 || err != nil {
+			return data, err
+		}
+	}
+}
+
+func trimSyslog(data []byte) []byte {
+	for len(data) > 0 {
+		switch data[len(data)-1] {
+		case '\n', '\r', 0:
+			data = data[:len(data)-1]
+		default:
+			return data
+		}
+	}
+	return data
+}
+
+// process turns received messages into events until the readers have
+// stopped and every message is handled. Events held by dedup are sent
+// once nothing arrives within the dedup window, and at the end.
+func (r *syslogReceiver) process(sink *sink) {
+	idle := time.NewTimer(time.Hour)
+	idle.Stop()
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-idle.C:
+			sink.flush()
+		case p, ok := <-r.packets:
+			if !ok {
+				sink.flush()
+				utils.InfoLogger.Printf("Stopped receiving syslog: %s", r.src.Name)
+				return
+			}
+			sink.add(r.event(p), FilePosition{})
+			if sink.pending() {
+				idle.Reset(sink.dd.window)
+			} else {
+				idle.Stop()
+			}
+		}
+	}
+}
+
+// event builds the event of a received message. The syslog header,
+// including facility, severity and hostname, becomes event fields along
+// with the sender's remote_addr; the parser's fields from the message
+// take precedence over them. A message that is not syslog is sent as is.
+func (r *syslogReceiver) event(p syslogPacket) LogEvent {
+	text := string(trimSyslog(p.data))
+	fields := map[string]any{}
+	msg, err := ParseSyslog([]byte(text), nil)
+	if err == nil {
+		fields = msg.Fields()
+		delete(fields, "message")
+		delete(fields, "time")
+		text = msg.Message
+	}
+	for name, value := range fields {
+		switch value := value.(type) {
+		case string:
+			fields[name] = r.stages.redactor.Redact(value)
+		case map[string]map[string]string:
+			for _, params := range value {
+				for param, v := range params {
+					params[param] = r.stages.redactor.Redact(v)
+				}
+			}
+		}
+	}
+	if p.remote != "" {
+		fields["remote_addr"] = p.remote
+	}
+
+	ev := r.parser.event(r.stages.redactor.Redact(text))
+	for name, value := range ev.Fields {
+		fields[name] = value
+	}
+	if len(fields) > 0 {
+		ev.Fields = fields
+	}
+	if ev.Time.IsZero() {
+		ev.Time = msg.Timestamp
+	}
+	ev.Source, ev.Labels, ev.ReadAt = r.src.Name, r.src.Labels, time.Now()
+	return ev
+}
@@ -0,0 +1,203 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSyslogFrame(t *testing.T) {
+	stream := "<13>Jan  2 03:04:05 host app: one\r\n" +
+		"\n" +
+		"27 <14>1 - - - - - - two\nlines" +
+		"<15>Jan  2 03:04:05 host app: three"
+	r := bufio.NewReader(strings.NewReader(stream))
+
+	var frames []string
+	for {
+		data, err := readSyslogFrame(r)
+		if len(data) > 0 {
+			frames = append(frames, string(data))
+		}
+		if err != nil {
+			assert.Equal(t, io.EOF, err)
+			break
+		}
+	}
+	assert.Equal(t, []string{
+		"<13>Jan  2 03:04:05 host app: one",
+		"<14>1 - - - - - - two\nlines",
+		"<15>Jan  2 03:04:05 host app: three",
+	}, frames)
+
+	_, err := readSyslogFrame(bufio.NewReader(strings.NewReader("99999999 <13>too long")))
+	assert.ErrorIs(t, err, errSyslogFrame)
+	_, err = readSyslogFrame(bufio.NewReader(strings.NewReader("12x <13>oops")))
+	assert.ErrorIs(t, err, errSyslogFrame)
+}
+
+func TestSyslogReceiver(t *testing.T) {
+	utils.InitLogger(true)
+	rule := &SyslogRule{UDP: "127.0.0.1:0", TCP: "127.0.0.1:0"}
+	if runtime.GOOS != "windows" {
+		// Socket paths are limited to about 100 bytes, shorter than
+		// some temporary directories.
+		dir, err := os.MkdirTemp("", "syslog")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		rule.Unix = filepath.Join(dir, "log.sock")
+	}
+	redactor, err := NewRedactor([]RedactRule{{Name: "password"}}, "")
+	require.NoError(t, err)
+
+	src := LogSource{Name: "syslog", Syslog: rule, Labels: map[string]string{"env": "prod"}}
+	r, err := listenSyslog(src, sourceStages{redactor: redactor})
+	require.NoError(t, err)
+
+	// A second receiver on the same address fails before starting.
+	_, err = listenSyslog(LogSource{Name: "taken", Syslog: &SyslogRule{TCP: r.ln.Addr().String()}}, sourceStages{})
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	out := make(chan tailedEvent, 10)
+	r.start(ctx, &wg, out)
+
+	udp, err := net.Dial("udp", r.conns[0].LocalAddr().String())
+	require.NoError(t, err)
+	defer udp.Close()
+	_, err = udp.Write([]byte(`<165>1 2025-01-01T12:00:00Z web01 nginx 42 ID7 [meta seq="1"] request done password=hunter2`))
+	require.NoError(t, err)
+
+	tcp, err := net.Dial("tcp", r.ln.Addr().String())
+	require.NoError(t, err)
+	defer tcp.Close()
+	_, err = tcp.Write([]byte("<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed\n17 not syslog at all\n"))
+	require.NoError(t, err)
+
+	want := 3
+	if rule.Unix != "" {
+		unix, err := net.Dial("unixgram", rule.Unix)
+		require.NoError(t, err)
+		defer unix.Close()
+		_, err = unix.Write([]byte("<13>Jan  2 03:04:05 host app: via socket"))
+		require.NoError(t, err)
+		want++
+	}
+
+	byText := map[string]LogEvent{}
+	for len(byText) < want {
+		select {
+		case item := <-out:
+			assert.Equal(t, FilePosition{}, item.pos)
+			byText[item.ev.Text] = item.ev
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of %d messages", len(byText), want)
+		}
+	}
+
+	ev := byText["request done password=[REDACTED]"]
+	assert.Equal(t, "syslog", ev.Source)
+	assert.Equal(t, map[string]string{"env": "prod"}, ev.Labels)
+	assert.Equal(t, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), ev.Time.UTC())
+	assert.Equal(t, 20, ev.Fields["facility"])
+	assert.Equal(t, 5, ev.Fields["severity"])
+	assert.Equal(t, "notice", ev.Fields["level"])
+	assert.Equal(t, "web01", ev.Fields["hostname"])
+	assert.Equal(t, map[string]map[string]string{"meta": {"seq": "1"}}, ev.Fields["sd"])
+	assert.Contains(t, ev.Fields["remote_addr"], "127.0.0.1:")
+	assert.NotContains(t, ev.Fields, "message")
+
+	ev = byText["'su root' failed"]
+	assert.Equal(t, "mymachine", ev.Fields["hostname"])
+	assert.Equal(t, "su", ev.Fields["app_name"])
+	assert.Equal(t, 2, ev.Fields["severity"])
+
+	ev = byText["not syslog at all"]
+	assert.Equal(t, map[string]any{"remote_addr": tcp.LocalAddr().String()}, ev.Fields)
+
+	if rule.Unix != "" {
+		assert.Equal(t, "app", byText["via socket"].Fields["app_name"])
+	}
+
+	cancel()
+	wg.Wait()
+	if rule.Unix != "" {
+		_, err := os.Stat(rule.Unix)
+		assert.True(t, os.IsNotExist(err), "socket removed")
+	}
+}
+
+func TestSyslogUnixSocketInUse(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix datagram sockets are not supported on Windows")
+	}
+	utils.InitLogger(true)
+	dir, err := os.MkdirTemp("", "syslog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "log.sock")
+	src := LogSource{Name: "syslog", Syslog: &SyslogRule{Unix: socket}}
+
+	// A socket another logger listens on is neither taken over nor removed.
+	live, err := net.ListenPacket("unixgram", socket)
+	require.NoError(t, err)
+	_, err = listenSyslog(src, sourceStages{})
+	assert.ErrorContains(t, err, "address in use")
+	_, err = os.Stat(socket)
+	assert.NoError(t, err)
+
+	// Once it is gone, the socket file it left behind is replaced.
+	live.Close()
+	r, err := listenSyslog(src, sourceStages{})
+	require.NoError(t, err)
+	r.stop()
+	_, err = os.Stat(socket)
+	assert.True(t, os.IsNotExist(err), "socket removed")
+}
+
+func TestSyslogReceiverStopSendsReceived(t *testing.T) {
+	utils.InitLogger(true)
+	r, err := listenSyslog(LogSource{Name: "syslog", Syslog: &SyslogRule{TCP: "127.0.0.1:0"}}, sourceStages{})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	out := make(chan tailedEvent)
+	r.start(ctx, &wg, out)
+
+	tcp, err := net.Dial("tcp", r.ln.Addr().String())
+	require.NoError(t, err)
+	defer tcp.Close()
+	_, err = tcp.Write([]byte("one\ntwo\nthree\n"))
+	require.NoError(t, err)
+
+	// One message waits for the batcher, the others behind it.
+	require.Eventually(t, func() bool { return len(r.packets) == 2 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case item := <-out:
+			got = append(got, item.ev.Text)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %v after stop", got)
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"one", "two", "three"}, got)
+}
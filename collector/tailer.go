@@ -1,6 +1,576 @@
-package collector
-
-type Tailer interface {
-	Start() error
-	Stop()
-}
+package collector
+
+import (
+	"context"
+	"io"
+	"os"
+	"revnoa/utils"
+	"sync"
+	"time"
+
+	"github.com/nxadm/tail"
+)
+
+type Tailer interface {
+	Start() error
+	Stop()
+}
+
+// FileTailer follows the files of a TailerConfig. One goroutine per file
+// reads and processes lines and feeds them through a bounded channel to a
+// single batching goroutine, which calls send.
+type FileTailer struct {
+	cfg    TailerConfig
+	events chan tailedEvent
+	batch  *batcher
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	readers  sync.WaitGroup
+	started  bool
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewTailer(cfg TailerConfig, send SendFunc) Tailer {
+	return NewFileTailer(cfg, send)
+}
+
+func NewFileTailer(cfg TailerConfig, send SendFunc) *FileTailer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &FileTailer{
+		cfg:    cfg,
+		events: make(chan tailedEvent, eventQueueSize),
+		batch:  newBatcher(cfg, send),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+func (t *FileTailer) Start() error {
+	t.started = true
+	files := newFileSet(t.cfg, t.events, &t.readers)
+	files.scan(t.ctx)
+
+	t.readers.Add(1)
+	go func() {
+		defer t.readers.Done()
+		files.rescan(t.ctx)
+	}()
+
+	for _, src := range t.cfg.sources() {
+		stages, ok := files.stages[src.Name]
+		switch {
+		case !ok:
+		case src.Journal != nil:
+			t.readers.Add(1)
+			go func() {
+				defer t.readers.Done()
+				followJournal(t.ctx, src, stages, t.cfg, t.events)
+			}()
+		case src.Syslog != nil:
+			r, err := listenSyslog(src, stages)
+			if err != nil {
+				utils.ErrorLogger.Printf("Failed to receive syslog for %s: %v", src.Name, err)
+				continue
+			}
+			r.start(t.ctx, &t.readers, t.events)
+		}
+	}
+
+	interval := time.Duration(t.cfg.FlushInterval) * time.Second
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	go func() {
+		defer close(t.done)
+		t.batch.run(t.events, interval)
+	}()
+
+	return nil
+}
+
+// Stop stops reading and returns once the events read so far have been
+// handed to send.
+func (t *FileTailer) Stop() {
+	t.stopOnce.Do(func() {
+		t.cancel()
+		t.readers.Wait()
+		close(t.events)
+		if t.started {
+			<-t.done
+		}
+	})
+}
+
+// tailConfig follows a file by name across rotation, starting at location.
+// A line still being written is only read once its newline arrives.
+func tailConfig(location *tail.SeekInfo) tail.Config {
+	return tail.Config{
+		Follow:        true,
+		ReOpen:        true,
+		MustExist:     false,
+		Poll:          pollFiles,
+		Location:      location,
+		CompleteLines: true,
+	}
+}
+
+// SendFunc delivers buffered events together with the position each file
+// has been read to. Positions should be committed once the events are sent.
+type SendFunc func(events []LogEvent, positions []FilePosition)
+
+// LogSource is a group of files, the systemd journal or a syslog
+// receiver, sharing the same processing rules. Labels are static
+// key/value pairs attached to every event, such as the service or
+// environment.
+type LogSource struct {
+	Name      string
+	Files     []string
+	Exclude   []string
+	Journal   *JournalRule
+	Syslog    *SyslogRule
+	Multiline *MultilineRule
+	Parser    *ParserRule
+	Filter    *FilterRule
+	Redact    []RedactRule
+	Labels    map[string]string
+}
+
+// TailerConfig configures NewTailer. Files, Exclude, Multiline, Parser,
+// Filter, Redact and Labels form the default source, followed by
+// Sources; a file matched by several sources belongs to the first.
+// Patterns are rescanned every ScanInterval seconds so new files are
+// picked up and deleted ones released. A batch is sent once it holds
+// BufferCount events or BufferBytes bytes of text, or every FlushInterval
+// seconds. Files present at startup without a stored position in
+// Positions are read from the start, or from the end with StartAtEnd;
+// files appearing later are always read from the start. RedactHashKey
+// keys the hash action of all redact rules.
+type TailerConfig struct {
+	Files         []string
+	Exclude       []string
+	Multiline     *MultilineRule
+	Parser        *ParserRule
+	Filter        *FilterRule
+	Redact        []RedactRule
+	RedactHashKey string
+	Labels        map[string]string
+	Sources       []LogSource
+	ScanInterval  int
+	BufferCount   int
+	BufferBytes   int
+	FlushInterval int
+	Positions     *Positions
+	StartAtEnd    bool
+}
+
+func (c TailerConfig) sources() []LogSource {
+	var sources []LogSource
+	if len(c.Files) > 0 {
+		sources = append(sources, LogSource{
+			Name:      "default",
+			Files:     c.Files,
+			Exclude:   c.Exclude,
+			Multiline: c.Multiline,
+			Parser:    c.Parser,
+			Filter:    c.Filter,
+			Redact:    c.Redact,
+			Labels:    c.Labels,
+		})
+	}
+	return append(sources, c.Sources...)
+}
+
+const (
+	// DefaultScanInterval is used when TailerConfig.ScanInterval is not set.
+	DefaultScanInterval = 10 * time.Second
+	// DefaultFlushInterval is used when TailerConfig.FlushInterval is not set.
+	DefaultFlushInterval = 5 * time.Second
+	// DefaultBufferBytes is used when TailerConfig.BufferBytes is not set.
+	DefaultBufferBytes = 1 << 20
+
+	// eventQueueSize bounds the events read ahead of the batcher; file
+	// readers block once it is full.
+	eventQueueSize = 1024
+)
+
+// tailedEvent is an event read from a file together with the position
+// right after it.
+type tailedEvent struct {
+	ev  LogEvent
+	pos FilePosition
+}
+
+// batcher collects the events of all tailed files and the latest
+// position per file, and hands both to send when a batch is full. It is
+// only used from the batching goroutine.
+type batcher struct {
+	events    []LogEvent
+	positions map[string]FilePosition
+	bytes     int
+	maxCount  int
+	maxBytes  int
+	send      SendFunc
+}
+
+func newBatcher(cfg TailerConfig, send SendFunc) *batcher {
+	b := &batcher{
+		maxCount:  cfg.BufferCount,
+		maxBytes:  cfg.BufferBytes,
+		send:      send,
+		positions: map[string]FilePosition{},
+	}
+	if b.maxBytes <= 0 {
+		b.maxBytes = DefaultBufferBytes
+	}
+	return b
+}
+
+// run batches events from in until it is closed, flushing on count, size
+// and every interval, and flushes what is left before returning.
+func (b *batcher) run(in <-chan tailedEvent, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case item, ok := <-in:
+			if !ok {
+				b.flush()
+				return
+			}
+			b.add(item)
+		case <-ticker.C:
+			b.flush()
+		}
+	}
+}
+
+func (b *batcher) add(item tailedEvent) {
+	b.events = append(b.events, item.ev)
+	// Received syslog messages have no position to commit.
+	if item.pos.Path != "" {
+		b.positions[item.pos.Path] = item.pos
+	}
+	b.bytes += len(item.ev.Text)
+	if len(b.events) >= b.maxCount || b.bytes >= b.maxBytes {
+		b.flush()
+	}
+}
+
+func (b *batcher) flush() {
+	if len(b.events) == 0 {
+		return
+	}
+	positions := make([]FilePosition, 0, len(b.positions))
+	for _, pos := range b.positions {
+		positions = append(positions, pos)
+	}
+	b.send(b.events, positions)
+	b.events = nil
+	b.bytes = 0
+	b.positions = map[string]FilePosition{}
+}
+
+// startLocation returns where tailing of file begins: the stored position
+// if there is one, otherwise the start or the end of the file.
+func startLocation(cfg TailerConfig, file string, initial bool) *tail.SeekInfo {
+	if cfg.Positions != nil {
+		if offset, ok := cfg.Positions.Resume(file); ok {
+			if offset > 0 {
+				utils.InfoLogger.Printf("Resuming %s at offset %d", file, offset)
+			}
+			return &tail.SeekInfo{Offset: offset, Whence: io.SeekStart}
+		}
+	}
+	if cfg.StartAtEnd && initial {
+		return &tail.SeekInfo{Offset: 0, Whence: io.SeekEnd}
+	}
+	return nil
+}
+
+// followFile tails one file until ctx is done, sending each event to out
+// with the offset right after it. Without a multiline rule every line is
+// an event; lines of an unfinished event are not committed, so they are
+// read again after a restart. Events are redacted, parsed by the source's
+// parser and then passed through its filter; dropped lines are committed
+// with the next event that is kept.
+func followFile(ctx context.Context, file string, src LogSource, stages sourceStages, tc tail.Config, out chan<- tailedEvent) {
+	ml, err := newMultiline(src.Multiline)
+	if err != nil {
+		utils.ErrorLogger.Printf("Invalid multiline pattern for %s, using single lines: %v", src.Name, err)
+	}
+	parser, err := newEventParser(src.Parser)
+	if err != nil {
+		utils.ErrorLogger.Printf("Invalid parser for %s, sending raw lines: %v", src.Name, err)
+	}
+	sink := newSink(ctx, src, stages, out)
+	emit := func(text string, pos FilePosition) {
+		ev := parser.event(stages.redactor.Redact(text))
+		ev.Source, ev.Path, ev.Labels, ev.ReadAt = src.Name, file, src.Labels, time.Now()
+		// Lines lose only their "\n", and multiline events are joined
+		// with "\n", so the raw text ends right before pos.
+		ev.Offset = max(pos.Offset-int64(len(text))-1, 0)
+		sink.add(ev, pos)
+	}
+
+	tailer, err := tail.TailFile(file, tc)
+	if err != nil {
+		utils.ErrorLogger.Printf("Failed to tail file: %s, err: %v", file, err)
+		return
+	}
+	defer tailer.Cleanup()
+	defer tailer.Stop()
+
+	idle := time.NewTimer(time.Hour)
+	idle.Stop()
+	defer idle.Stop()
+
+	cursor := FilePosition{Path: file}
+	for {
+		select {
+		case <-ctx.Done():
+			utils.InfoLogger.Printf("Stopped tailing: %s", file)
+			return
+		case <-idle.C:
+			if ml != nil {
+				ml.flush(emit)
+			}
+			sink.flush()
+		case line, ok := <-tailer.Lines:
+			if !ok {
+				utils.WarnLogger.Printf("Tail stopped for file: %s", file)
+				return
+			}
+			if line.Err != nil {
+				utils.WarnLogger.Printf("Tail error on %s: %v", file, line.Err)
+				continue
+			}
+
+			// The offset going back means the file was reopened after
+			// rotation or truncation; a short fingerprint is extended
+			// until it covers fingerprintSize bytes.
+			offset := line.SeekInfo.Offset
+			if cursor.Fingerprint == "" || offset < cursor.Offset ||
+				(cursor.FingerprintSize < fingerprintSize && offset > cursor.FingerprintSize) {
+				if pos, err := statPosition(file, 0); err == nil {
+					cursor = pos
+				}
+			}
+			cursor.Offset = offset
+
+			if ml == nil {
+				emit(line.Text, cursor)
+			} else {
+				ml.add(line.Text, cursor, emit)
+			}
+
+			// Pending events are sent once the file has been idle
+			// for the multiline timeout or the dedup window.
+			switch {
+			case ml != nil && ml.pending():
+				idle.Reset(ml.timeout)
+			case sink.pending():
+				idle.Reset(sink.dd.window)
+			default:
+				idle.Stop()
+			}
+		}
+	}
+}
+
+// sink runs the filter stages of a source on its processed events and
+// sends those kept to out, or gives up once ctx is done.
+type sink struct {
+	ctx    context.Context
+	filter *logFilter
+	dd     *dedup
+	out    chan<- tailedEvent
+}
+
+func newSink(ctx context.Context, src LogSource, stages sourceStages, out chan<- tailedEvent) *sink {
+	s := &sink{ctx: ctx, filter: stages.filter, out: out}
+	if s.filter != nil && s.filter.dedup {
+		s.dd = &dedup{source: src.Name, window: dedupWindow}
+	}
+	return s
+}
+
+func (s *sink) add(ev LogEvent, pos FilePosition) {
+	if !s.filter.match(ev) {
+		return
+	}
+	if s.dd != nil {
+		s.dd.add(ev, pos, s.keep)
+		return
+	}
+	s.keep(ev, pos)
+}
+
+func (s *sink) keep(ev LogEvent, pos FilePosition) {
+	if !s.filter.sample(ev) {
+		return
+	}
+	select {
+	case s.out <- tailedEvent{ev: ev, pos: pos}:
+	case <-s.ctx.Done():
+	}
+}
+
+// pending reports whether dedup holds an event that flush would send.
+func (s *sink) pending() bool {
+	return s.dd != nil && s.dd.pending()
+}
+
+func (s *sink) flush() {
+	if s.dd != nil {
+		s.dd.flush(s.keep)
+	}
+}
+
+// fileSet follows the files matching a TailerConfig and starts or stops
+// followers as matching files appear and disappear.
+type fileSet struct {
+	cfg    TailerConfig
+	out    chan<- tailedEvent
+	wg     *sync.WaitGroup
+	stages map[string]sourceStages
+
+	mu      sync.Mutex
+	running map[string]*follower
+	scanned bool
+}
+
+type follower struct {
+	cancel context.CancelFunc
+}
+
+// sourceStages holds the compiled rules of a source, shared by the
+// followers of its files.
+type sourceStages struct {
+	redactor *Redactor
+	filter   *logFilter
+}
+
+func newFileSet(cfg TailerConfig, out chan<- tailedEvent, wg *sync.WaitGroup) *fileSet {
+	stages := map[string]sourceStages{}
+	for _, src := range cfg.sources() {
+		var st sourceStages
+		var err error
+		if st.filter, err = newLogFilter(src.Name, src.Filter); err != nil {
+			utils.ErrorLogger.Printf("Invalid filter for %s, sending all lines: %v", src.Name, err)
+		}
+		if st.redactor, err = NewRedactor(src.Redact, cfg.RedactHashKey); err != nil {
+			// Shipping unredacted lines could leak secrets, so the
+			// source is not tailed at all.
+			utils.ErrorLogger.Printf("Invalid redact rules for %s, not tailing it: %v", src.Name, err)
+			continue
+		}
+		stages[src.Name] = st
+	}
+
+	return &fileSet{
+		cfg:     cfg,
+		out:     out,
+		wg:      wg,
+		stages:  stages,
+		running: map[string]*follower{},
+	}
+}
+
+// scan starts followers for newly matched files and stops those whose
+// file no longer exists.
+func (s *fileSet) scan(ctx context.Context) {
+	var files []string
+	sourceOf := map[string]LogSource{}
+	patterns := 0
+	for _, src := range s.cfg.sources() {
+		if _, ok := s.stages[src.Name]; !ok {
+			continue
+		}
+		patterns += len(src.Files)
+		for _, file := range DiscoverFiles(src.Files, src.Exclude) {
+			if _, ok := sourceOf[file]; !ok {
+				sourceOf[file] = src
+				files = append(files, file)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	initial := !s.scanned
+	s.scanned = true
+	if initial && patterns > 0 && len(files) == 0 {
+		utils.WarnLogger.Println("No log files match yet, waiting for them to appear")
+	}
+
+	current := make(map[string]bool, len(files))
+	for _, file := range files {
+		current[file] = true
+		if _, ok := s.running[file]; ok {
+			continue
+		}
+
+		if !initial {
+			utils.InfoLogger.Printf("Started tailing new file: %s", file)
+		}
+		fctx, cancel := context.WithCancel(ctx)
+		f := &follower{cancel: cancel}
+		s.running[file] = f
+		tc := tailConfig(startLocation(s.cfg, file, initial))
+
+		s.wg.Add(1)
+		go func(file string, src LogSource) {
+			defer s.wg.Done()
+			followFile(fctx, file, src, s.stages[src.Name], tc, s.out)
+			s.release(file, f)
+		}(file, sourceOf[file])
+	}
+
+	for file, f := range s.running {
+		if current[file] {
+			continue
+		}
+		if _, err := os.Stat(file); err == nil {
+			continue
+		}
+		utils.InfoLogger.Printf("Released removed file: %s", file)
+		f.cancel()
+		delete(s.running, file)
+	}
+}
+
+// release forgets a follower that has stopped, so a later scan can
+// restart it.
+func (s *fileSet) release(file string, f *follower) {
+	f.cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[file] == f {
+		delete(s.running, file)
+	}
+}
+
+// rescan calls scan every interval until ctx is done.
+func (s *fileSet) rescan(ctx context.Context) {
+	interval := time.Duration(s.cfg.ScanInterval) * time.Second
+	if interval <= 0 {
+		interval = DefaultScanInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.scan(ctx)
+		}
+	}
+}
@@ -1,12 +1,18 @@
 package collector_test
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"revnoa/collector"
 	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTailerBasic(t *testing.T) {
@@ -21,8 +27,11 @@ func TestTailerBasic(t *testing.T) {
 	linesCollected := []string{}
 	done := make(chan struct{})
 
-	tailer := collector.NewTailer([]string{tmpFile.Name()}, 2, 2, func(lines []string) {
-		linesCollected = append(linesCollected, lines...)
+	cfg := collector.TailerConfig{Files: []string{tmpFile.Name()}, BufferCount: 2, FlushInterval: 2}
+	tailer := collector.NewTailer(cfg, func(events []collector.LogEvent, _ []collector.FilePosition) {
+		for _, ev := range events {
+			linesCollected = append(linesCollected, ev.Text)
+		}
 		if len(linesCollected) >= 2 {
 			close(done)
 		}
@@ -44,3 +53,141 @@ func TestTailerBasic(t *testing.T) {
 
 	tailer.Stop()
 }
+
+// collect returns a SendFunc that records batches, safe for concurrent
+// inspection.
+func collect() (collector.SendFunc, func() [][]collector.LogEvent) {
+	var mu sync.Mutex
+	var batches [][]collector.LogEvent
+	send := func(events []collector.LogEvent, _ []collector.FilePosition) {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, events)
+	}
+	get := func() [][]collector.LogEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([][]collector.LogEvent(nil), batches...)
+	}
+	return send, get
+}
+
+func countEvents(batches [][]collector.LogEvent) int {
+	n := 0
+	for _, b := range batches {
+		n += len(b)
+	}
+	return n
+}
+
+func TestTailerConcurrentFiles(t *testing.T) {
+	utils.InitLogger(true)
+	dir := t.TempDir()
+	const files, lines = 8, 200
+
+	for i := 0; i < files; i++ {
+		var content []byte
+		for n := 0; n < lines; n++ {
+			content = fmt.Appendf(content, "file %d line %d\n", i, n)
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("app%d.log", i)), content, 0644))
+	}
+
+	send, batches := collect()
+	cfg := collector.TailerConfig{
+		Files:         []string{filepath.Join(dir, "*.log")},
+		BufferCount:   50,
+		BufferBytes:   512,
+		FlushInterval: 1,
+	}
+	tailer := collector.NewTailer(cfg, send)
+	require.NoError(t, tailer.Start())
+
+	require.Eventually(t, func() bool {
+		return countEvents(batches()) == files*lines
+	}, 10*time.Second, 20*time.Millisecond)
+	tailer.Stop()
+
+	seen := map[string]bool{}
+	for _, b := range batches() {
+		assert.LessOrEqual(t, len(b), 50)
+		for _, ev := range b {
+			assert.False(t, seen[ev.Text], "duplicate %q", ev.Text)
+			seen[ev.Text] = true
+		}
+	}
+	assert.Len(t, seen, files*lines)
+}
+
+func TestTailerFlushesOnSize(t *testing.T) {
+	utils.InitLogger(true)
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("aaaaaa\nbbbbbb\ncc\n"), 0644))
+
+	send, batches := collect()
+	cfg := collector.TailerConfig{Files: []string{path}, BufferCount: 1000, BufferBytes: 10, FlushInterval: 3600}
+	tailer := collector.NewTailer(cfg, send)
+	require.NoError(t, tailer.Start())
+	defer tailer.Stop()
+
+	require.Eventually(t, func() bool {
+		return len(batches()) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	got := batches()[0]
+	require.Len(t, got, 2)
+	assert.Equal(t, "bbbbbb", got[1].Text)
+}
+
+func TestTailerStopFlushesBuffer(t *testing.T) {
+	utils.InitLogger(true)
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("one\ntwo\nthree\n"), 0644))
+
+	send, batches := collect()
+	cfg := collector.TailerConfig{Files: []string{path}, BufferCount: 1000, FlushInterval: 3600}
+	tailer := collector.NewTailer(cfg, send)
+	require.NoError(t, tailer.Start())
+
+	time.Sleep(time.Second)
+	assert.Empty(t, batches())
+	tailer.Stop()
+
+	require.Len(t, batches(), 1)
+	var texts []string
+	for _, ev := range batches()[0] {
+		texts = append(texts, ev.Text)
+	}
+	assert.Equal(t, []string{"one", "two", "three"}, texts)
+	tailer.Stop()
+}
+
+func TestTailerWaitsForCompleteLines(t *testing.T) {
+	utils.InitLogger(true)
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("first\nsec"), 0644))
+
+	send, batches := collect()
+	cfg := collector.TailerConfig{Files: []string{path}, BufferCount: 1, FlushInterval: 1}
+	tailer := collector.NewTailer(cfg, send)
+	require.NoError(t, tailer.Start())
+	defer tailer.Stop()
+
+	require.Eventually(t, func() bool { return countEvents(batches()) == 1 }, 5*time.Second, 20*time.Millisecond)
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, 1, countEvents(batches()), "the unfinished line is held back")
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("ond\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.Eventually(t, func() bool { return countEvents(batches()) == 2 }, 5*time.Second, 20*time.Millisecond)
+	var events []collector.LogEvent
+	for _, b := range batches() {
+		events = append(events, b...)
+	}
+	assert.Equal(t, "first", events[0].Text)
+	assert.Equal(t, "second", events[1].Text)
+	assert.Equal(t, int64(6), events[1].Offset)
+}
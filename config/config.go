@@ -1,180 +1,620 @@
-package config
-
-import (
-	"fmt"
-	"os"
-	"path/filepath"
-	"revnoa/utils"
-	"strings"
-
-	"github.com/google/uuid"
-	"gopkg.in/yaml.v2"
-)
-
-type Config struct {
-	UUID       string        `yaml:"uuid"`
-	Interval   int           `yaml:"interval"`
-	RetryCount int           `yaml:"retry_count"`
-	API        APIConfig     `yaml:"api"`
-	Collectors CollectorSet  `yaml:"collectors"`
-	Storage    StorageConfig `yaml:"storage"`
-	HTTPServer HTTPServer    `yaml:"http_server"`
-}
-
-type APIConfig struct {
-	Server    string `yaml:"server"`
-	Heartbeat string `yaml:"heartbeat"`
-	Log       string `yaml:"log"`
-	AuthKey   string `yaml:"auth_key"`
-}
-
-type CollectorSet struct {
-	CPU    CPUCollector  `yaml:"cpu"`
-	Mem    MemCollector  `yaml:"mem"`
-	Net    GenericSwitch `yaml:"net"`
-	Disk   GenericSwitch `yaml:"disk"`
-	Ports  GenericSwitch `yaml:"ports"`
-	Host   GenericSwitch `yaml:"host"`
-	Docker GenericSwitch `yaml:"docker"`
-	Redis  RedisConfig   `yaml:"redis"`
-	Log    LogCollector  `yaml:"log"`
-}
-
-type GenericSwitch struct {
-	Enabled bool `yaml:"enabled"`
-}
-
-type CPUCollector struct {
-	Enabled bool `yaml:"enabled"`
-}
-
-type MemCollector struct {
-	Enabled bool `yaml:"enabled"`
-}
-
-type RedisConfig struct {
-	Enabled bool   `yaml:"enabled"`
-	Addr    string `yaml:"addr"`
-}
-
-type LogCollector struct {
-	Enabled       bool     `yaml:"enabled"`
-	BufferCount   int      `yaml:"buffer_count"`
-	FlushInterval int      `yaml:"flush_interval"`
-	Files         []string `yaml:"files"`
-}
-
-type StorageConfig struct {
-	FileBackup FileBackupConfig `yaml:"file_backup"`
-}
-
-type FileBackupConfig struct {
-	Enabled bool   `yaml:"enabled"`
-	Dir     string `yaml:"dir"`
-}
-
-type HTTPServer struct {
-	Enabled bool `yaml:"enabled"`
-	Port    int  `yaml:"port"`
-}
-
-func LoadConfig(path string) (*Config, error) {
-	cfg := &Config{}
-	data, err := os.ReadFile(path)
-	if err != nil {
-		utils.ErrorLogger.Printf("Failed to read config file: %v", err)
-		return nil, err
-	}
-
-	err = yaml.Unmarshal(data, cfg)
-	if err != nil {
-		utils.ErrorLogger.Printf("Failed to parse config file: %v", err)
-		return nil, err
-	}
-
-	for i, file := range cfg.Collectors.Log.Files {
-		cfg.Collectors.Log.Files[i] = filepath.Clean(file)
-	}
-
-	if cfg.UUID == "" {
-		newUUID := uuid.New().String()
-		cfg.UUID = newUUID
-		_ = injectUUIDToFile(path, newUUID)
-		utils.InfoLogger.Printf("Generated UUID: %s", newUUID)
-	}
-
-	utils.InfoLogger.Println("Config loaded successfully")
-	return cfg, nil
-}
-
-func (c *Config) Validate() error {
-	var errs []string
-
-	if strings.TrimSpace(c.UUID) == "" {
-		errs = append(errs, "UUID must not be empty")
-	}
-	if strings.TrimSpace(c.API.Log) == "" {
-		errs = append(errs, "API.Log must not be empty")
-	}
-	if c.Interval <= 0 {
-		errs = append(errs, "Interval must be greater than 0")
-	}
-	if c.RetryCount < 0 {
-		errs = append(errs, "RetryCount must be non-negative")
-	}
-	if c.Collectors.Log.Enabled {
-		if c.Collectors.Log.BufferCount <= 0 {
-			errs = append(errs, "Log buffer_count must be > 0")
-		}
-		if c.Collectors.Log.FlushInterval <= 0 {
-			errs = append(errs, "Log flush_interval must be > 0")
-		}
-		if len(c.Collectors.Log.Files) == 0 {
-			errs = append(errs, "Log files must include at least one path")
-		}
-	}
-	if c.Storage.FileBackup.Enabled && strings.TrimSpace(c.Storage.FileBackup.Dir) == "" {
-		utils.WarnLogger.Println("File backup is enabled but dir is empty")
-	}
-
-	if c.Collectors.Redis.Enabled && strings.TrimSpace(c.Collectors.Redis.Addr) == "" {
-		errs = append(errs, "Redis address must be set if redis is enabled")
-	}
-
-	if c.HTTPServer.Enabled && c.HTTPServer.Port <= 0 {
-		errs = append(errs, "HTTP server port must be > 0 if enabled")
-	}
-
-	if len(errs) > 0 {
-		return fmt.Errorf("config validation failed:\n  - %s", strings.Join(errs, "\n  - "))
-	}
-	return nil
-}
-
-func injectUUIDToFile(path, newUUID string) error {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		utils.ErrorLogger.Printf("Failed to read config for UUID injection: %v", err)
-		return err
-	}
-
-	lines := strings.Split(string(content), "\n")
-	found := false
-	for i, line := range lines {
-		if strings.HasPrefix(strings.TrimSpace(line), "uuid:") {
-			lines[i] = fmt.Sprintf("uuid: \"%s\"", newUUID)
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		lines = append([]string{fmt.Sprintf("uuid: \"%s\"", newUUID)}, lines...)
-	}
-
-	err = os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
-	if err != nil {
-		utils.ErrorLogger.Printf("Failed to write UUID to config: %v", err)
-	}
-	return err
-}
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"revnoa/utils"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v2"
+)
+
+type Config struct {
+	UUID       string        `yaml:"uuid"`
+	Interval   int           `yaml:"interval"`
+	RetryCount int           `yaml:"retry_count"`
+	API        APIConfig     `yaml:"api"`
+	Collectors CollectorSet  `yaml:"collectors"`
+	Storage    StorageConfig `yaml:"storage"`
+	HTTPServer HTTPServer    `yaml:"http_server"`
+	Sender     SenderConfig  `yaml:"sender"`
+}
+
+type APIConfig struct {
+	Server    string `yaml:"server"`
+	Heartbeat string `yaml:"heartbeat"`
+	Log       string `yaml:"log"`
+	Events    string `yaml:"events"`
+	AuthKey   string `yaml:"auth_key"`
+}
+
+type CollectorSet struct {
+	CPU    CPUCollector  `yaml:"cpu"`
+	Mem    MemCollector  `yaml:"mem"`
+	Net    GenericSwitch `yaml:"net"`
+	Disk   GenericSwitch `yaml:"disk"`
+	Ports  GenericSwitch `yaml:"ports"`
+	Host   GenericSwitch `yaml:"host"`
+	Docker DockerConfig  `yaml:"docker"`
+	Redis  RedisConfig   `yaml:"redis"`
+	Log    LogCollector  `yaml:"log"`
+}
+
+// CollectorOptions holds the settings every metrics collector accepts.
+// Interval and Timeout are in seconds; 0 falls back to the defaults.
+type CollectorOptions struct {
+	Enabled  bool `yaml:"enabled"`
+	Interval int  `yaml:"interval"`
+	Timeout  int  `yaml:"timeout"`
+}
+
+type GenericSwitch struct {
+	CollectorOptions `yaml:",inline"`
+}
+
+type CPUCollector struct {
+	CollectorOptions `yaml:",inline"`
+}
+
+type MemCollector struct {
+	CollectorOptions `yaml:",inline"`
+}
+
+// DockerConfig selects the Docker or Podman daemon. Host is a unix://
+// socket or tcp:// address, empty for $DOCKER_HOST or the local socket.
+// APIVersion pins the API version instead of negotiating it. The TLS
+// files are PEM and only used with tcp:// hosts. RunningOnly and Labels
+// ("key" or "key=value") limit the containers reported. Events watches
+// the daemon's container events and sends them to api.events, on its own
+// or along with the collector.
+type DockerConfig struct {
+	CollectorOptions `yaml:",inline"`
+	Host             string   `yaml:"host"`
+	APIVersion       string   `yaml:"api_version"`
+	TLSCA            string   `yaml:"tls_ca"`
+	TLSCert          string   `yaml:"tls_cert"`
+	TLSKey           string   `yaml:"tls_key"`
+	RunningOnly      bool     `yaml:"running_only"`
+	Labels           []string `yaml:"labels"`
+	Events           bool     `yaml:"events"`
+}
+
+type RedisConfig struct {
+	CollectorOptions `yaml:",inline"`
+	Addr             string `yaml:"addr"`
+}
+
+type LogCollector struct {
+	Enabled        bool              `yaml:"enabled"`
+	BufferCount    int               `yaml:"buffer_count"`
+	BufferBytes    int               `yaml:"buffer_bytes"`
+	FlushInterval  int               `yaml:"flush_interval"`
+	MaxPending     int               `yaml:"max_pending"`
+	PayloadVersion int               `yaml:"payload_version"`
+	PositionsFile  string            `yaml:"positions_file"`
+	StartAt        string            `yaml:"start_at"`
+	ScanInterval   int               `yaml:"scan_interval"`
+	Files          []string          `yaml:"files"`
+	Exclude        []string          `yaml:"exclude"`
+	Multiline      MultilineConfig   `yaml:"multiline"`
+	Parser         ParserConfig      `yaml:"parser"`
+	Filter         FilterConfig      `yaml:"filter"`
+	Redact         []RedactConfig    `yaml:"redact"`
+	RedactHashKey  string            `yaml:"redact_hash_key"`
+	Labels         map[string]string `yaml:"labels"`
+	Sources        []LogSource       `yaml:"sources"`
+}
+
+// LogSource is a group of log files, the systemd journal or a syslog
+// receiver, with its own processing rules.
+type LogSource struct {
+	Name      string            `yaml:"name"`
+	Files     []string          `yaml:"files"`
+	Exclude   []string          `yaml:"exclude"`
+	Journal   JournalConfig     `yaml:"journal"`
+	Syslog    SyslogConfig      `yaml:"syslog"`
+	Multiline MultilineConfig   `yaml:"multiline"`
+	Parser    ParserConfig      `yaml:"parser"`
+	Filter    FilterConfig      `yaml:"filter"`
+	Redact    []RedactConfig    `yaml:"redact"`
+	Labels    map[string]string `yaml:"labels"`
+}
+
+// JournalConfig reads the systemd journal through journalctl. Priority
+// is the least severe level to read, as a name (emerg, alert, crit, err,
+// warning, notice, info, debug), a number or a range like "err..info".
+// Directory reads journal files from there instead of the system journal.
+type JournalConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	Units       []string `yaml:"units"`
+	Identifiers []string `yaml:"identifiers"`
+	Priority    string   `yaml:"priority"`
+	Directory   string   `yaml:"directory"`
+}
+
+// SyslogConfig receives syslog messages. UDP and TCP are listen
+// addresses such as ":514" and Unix is the path of a datagram socket.
+type SyslogConfig struct {
+	UDP  string `yaml:"udp"`
+	TCP  string `yaml:"tcp"`
+	Unix string `yaml:"unix"`
+}
+
+func (s SyslogConfig) enabled() bool {
+	return s.UDP != "" || s.TCP != "" || s.Unix != ""
+}
+
+// MultilineConfig joins lines into one event. Timeout is in seconds.
+type MultilineConfig struct {
+	Pattern  string `yaml:"pattern"`
+	Negate   bool   `yaml:"negate"`
+	Match    string `yaml:"match"`
+	MaxLines int    `yaml:"max_lines"`
+	Timeout  int    `yaml:"timeout"`
+}
+
+// ParserConfig extracts fields from each event. Type is json, logfmt,
+// regex, nginx, apache or syslog; Pattern is the regex with named groups.
+// TimeFormat is a Go time layout.
+type ParserConfig struct {
+	Type       string `yaml:"type"`
+	Pattern    string `yaml:"pattern"`
+	TimeField  string `yaml:"time_field"`
+	TimeFormat string `yaml:"time_format"`
+}
+
+// FilterConfig drops or thins out events. Include and Exclude are
+// regexes, DropLevels needs a parser that yields a level field, and
+// RateLimit is in lines per second.
+type FilterConfig struct {
+	Include    []string `yaml:"include"`
+	Exclude    []string `yaml:"exclude"`
+	DropLevels []string `yaml:"drop_levels"`
+	SampleRate float64  `yaml:"sample_rate"`
+	RateLimit  int      `yaml:"rate_limit"`
+	Dedup      bool     `yaml:"dedup"`
+}
+
+// RedactConfig masks or hashes sensitive values. Without a pattern, Name
+// is one of the built-in detectors: bearer_token, password, card_number,
+// kr_rrn or email.
+type RedactConfig struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+	Action  string `yaml:"action"`
+}
+
+var builtinRedactors = map[string]bool{
+	"bearer_token": true,
+	"password":     true,
+	"card_number":  true,
+	"kr_rrn":       true,
+	"email":        true,
+}
+
+type StorageConfig struct {
+	FileBackup FileBackupConfig `yaml:"file_backup"`
+}
+
+// FileBackupConfig controls the on-disk queue of undelivered payloads.
+// Sizes are in bytes and MaxAge in seconds; zero means the default.
+type FileBackupConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Dir         string `yaml:"dir"`
+	SegmentSize int64  `yaml:"segment_size"`
+	MaxSize     int64  `yaml:"max_size"`
+	MaxAge      int    `yaml:"max_age"`
+	Fsync       string `yaml:"fsync"`
+	ReplayRate  int    `yaml:"replay_rate"`
+	Archive     bool   `yaml:"archive"`
+}
+
+// SenderConfig tunes outgoing requests. Timeout and backoff values are in
+// seconds; zero means the default.
+type SenderConfig struct {
+	Concurrency      int    `yaml:"concurrency"`
+	BufferSize       int    `yaml:"buffer_size"`
+	Timeout          int    `yaml:"timeout"`
+	BatchMaxItems    int    `yaml:"batch_max_items"`
+	BatchMaxBytes    int    `yaml:"batch_max_bytes"`
+	BatchFormat      string `yaml:"batch_format"`
+	Compression      string `yaml:"compression"`
+	FailureThreshold int    `yaml:"failure_threshold"`
+	BackoffBase      int    `yaml:"backoff_base"`
+	BackoffMax       int    `yaml:"backoff_max"`
+}
+
+type HTTPServer struct {
+	Enabled bool `yaml:"enabled"`
+	Port    int  `yaml:"port"`
+	MaxAge  int  `yaml:"max_age"`
+}
+
+// LoadConfig reads the config file at path. A missing UUID is generated
+// and written back to the file.
+func LoadConfig(path string) (*Config, error) {
+	cfg, err := ReadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.UUID == "" {
+		newUUID := uuid.New().String()
+		cfg.UUID = newUUID
+		_ = injectUUIDToFile(path, newUUID)
+		utils.InfoLogger.Printf("Generated UUID: %s", newUUID)
+	}
+
+	utils.InfoLogger.Println("Config loaded successfully")
+	return cfg, nil
+}
+
+// ReadConfig reads the config file at path without ever changing it, so a
+// missing UUID stays empty.
+func ReadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		utils.ErrorLogger.Printf("Failed to read config file: %v", err)
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(data, cfg)
+	if err != nil {
+		utils.ErrorLogger.Printf("Failed to parse config file: %v", err)
+		return nil, err
+	}
+
+	for i, file := range cfg.Collectors.Log.Files {
+		cfg.Collectors.Log.Files[i] = filepath.Clean(file)
+	}
+	for _, src := range cfg.Collectors.Log.Sources {
+		for i, file := range src.Files {
+			src.Files[i] = filepath.Clean(file)
+		}
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) Validate() error {
+	var errs []string
+
+	if strings.TrimSpace(c.UUID) == "" {
+		errs = append(errs, "UUID must not be empty")
+	}
+	if strings.TrimSpace(c.API.Log) == "" {
+		errs = append(errs, "API.Log must not be empty")
+	}
+	if c.Interval <= 0 {
+		errs = append(errs, "Interval must be greater than 0")
+	}
+	if c.RetryCount < 0 {
+		errs = append(errs, "RetryCount must be non-negative")
+	}
+	if c.Collectors.Log.Enabled {
+		if c.Collectors.Log.BufferCount <= 0 {
+			errs = append(errs, "Log buffer_count must be > 0")
+		}
+		if c.Collectors.Log.BufferBytes < 0 {
+			errs = append(errs, "Log buffer_bytes must be non-negative")
+		}
+		if c.Collectors.Log.FlushInterval <= 0 {
+			errs = append(errs, "Log flush_interval must be > 0")
+		}
+		if c.Collectors.Log.MaxPending < 0 {
+			errs = append(errs, "Log max_pending must be non-negative")
+		}
+		switch c.Collectors.Log.StartAt {
+		case "", "beginning", "end":
+		default:
+			errs = append(errs, fmt.Sprintf("Log start_at must be beginning or end, got %q", c.Collectors.Log.StartAt))
+		}
+		if c.Collectors.Log.ScanInterval < 0 {
+			errs = append(errs, "Log scan_interval must be non-negative")
+		}
+		if v := c.Collectors.Log.PayloadVersion; v < 0 || v > 2 {
+			errs = append(errs, fmt.Sprintf("Log payload_version must be 1 or 2, got %d", v))
+		}
+		errs = append(errs, validateLogSource("Log", c.Collectors.Log.Files, c.Collectors.Log.Exclude, c.Collectors.Log.Multiline)...)
+		errs = append(errs, validateParser("Log", c.Collectors.Log.Parser)...)
+		errs = append(errs, validateFilter("Log", c.Collectors.Log.Filter, c.Collectors.Log.Parser)...)
+		errs = append(errs, validateRedact("Log", c.Collectors.Log.Redact)...)
+		// Rules, journal cursors and drop counters are kept by source
+		// name; "default" names the top-level files.
+		names := map[string]bool{}
+		for i, src := range c.Collectors.Log.Sources {
+			prefix := fmt.Sprintf("Log source %q", src.Name)
+			switch {
+			case src.Name == "":
+				errs = append(errs, fmt.Sprintf("Log source #%d must have a name", i+1))
+			case src.Name == "default":
+				errs = append(errs, prefix+" is reserved for collectors.log.files, pick another name")
+			case names[src.Name]:
+				errs = append(errs, prefix+" is defined more than once")
+			}
+			names[src.Name] = true
+			kinds := 0
+			for _, set := range []bool{len(src.Files) > 0, src.Journal.Enabled, src.Syslog.enabled()} {
+				if set {
+					kinds++
+				}
+			}
+			switch {
+			case kinds > 1:
+				errs = append(errs, prefix+" must read only one of files, journal or syslog")
+			case kinds == 0:
+				errs = append(errs, prefix+" files must include at least one path")
+			}
+			errs = append(errs, validateJournal(prefix, src.Journal)...)
+			errs = append(errs, validateSyslog(prefix, src.Syslog)...)
+			errs = append(errs, validateLogSource(prefix, src.Files, src.Exclude, src.Multiline)...)
+			errs = append(errs, validateParser(prefix, src.Parser)...)
+			errs = append(errs, validateFilter(prefix, src.Filter, src.Parser)...)
+			errs = append(errs, validateRedact(prefix, src.Redact)...)
+		}
+		if len(c.Collectors.Log.Files) == 0 && len(c.Collectors.Log.Sources) == 0 {
+			errs = append(errs, "Log files must include at least one path")
+		}
+	}
+	if c.Storage.FileBackup.Enabled && strings.TrimSpace(c.Storage.FileBackup.Dir) == "" {
+		utils.WarnLogger.Println("File backup is enabled but dir is empty")
+	}
+	switch c.Storage.FileBackup.Fsync {
+	case "", "always", "interval", "never":
+	default:
+		errs = append(errs, "File backup fsync must be one of always, interval, never")
+	}
+	if c.Storage.FileBackup.SegmentSize < 0 || c.Storage.FileBackup.MaxSize < 0 || c.Storage.FileBackup.MaxAge < 0 || c.Storage.FileBackup.ReplayRate < 0 {
+		errs = append(errs, "File backup segment_size, max_size, max_age and replay_rate must be non-negative")
+	}
+	if c.Storage.FileBackup.MaxSize > 0 && c.Storage.FileBackup.MaxSize < c.Storage.FileBackup.SegmentSize {
+		errs = append(errs, "File backup max_size must not be smaller than segment_size")
+	}
+
+	if c.Collectors.Docker.Enabled || c.Collectors.Docker.Events {
+		errs = append(errs, validateDocker(c.Collectors.Docker)...)
+	}
+	if c.Collectors.Docker.Events && strings.TrimSpace(c.API.Events) == "" {
+		errs = append(errs, "API.Events must be set if docker events are enabled")
+	}
+
+	if c.Collectors.Redis.Enabled && strings.TrimSpace(c.Collectors.Redis.Addr) == "" {
+		errs = append(errs, "Redis address must be set if redis is enabled")
+	}
+
+	if c.HTTPServer.Enabled && c.HTTPServer.Port <= 0 {
+		errs = append(errs, "HTTP server port must be > 0 if enabled")
+	}
+	if c.HTTPServer.MaxAge < 0 {
+		errs = append(errs, "HTTP server max_age must be non-negative")
+	}
+
+	if c.Sender.Concurrency < 0 || c.Sender.BufferSize < 0 || c.Sender.Timeout < 0 {
+		errs = append(errs, "Sender concurrency, buffer_size and timeout must be non-negative")
+	}
+	if c.Sender.BatchMaxItems < 0 || c.Sender.BatchMaxBytes < 0 {
+		errs = append(errs, "Sender batch_max_items and batch_max_bytes must be non-negative")
+	}
+	switch c.Sender.BatchFormat {
+	case "", "json", "ndjson":
+	default:
+		errs = append(errs, fmt.Sprintf("Sender batch_format must be json or ndjson, got %q", c.Sender.BatchFormat))
+	}
+	switch c.Sender.Compression {
+	case "", "none", "gzip", "zstd":
+	default:
+		errs = append(errs, fmt.Sprintf("Sender compression must be none, gzip or zstd, got %q", c.Sender.Compression))
+	}
+	if c.Sender.FailureThreshold < 0 || c.Sender.BackoffBase < 0 || c.Sender.BackoffMax < 0 {
+		errs = append(errs, "Sender failure_threshold, backoff_base and backoff_max must be non-negative")
+	}
+	if c.Sender.BackoffMax > 0 && c.Sender.BackoffMax < c.Sender.BackoffBase {
+		errs = append(errs, "Sender backoff_max must not be smaller than backoff_base")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config validation failed:\n  - %s", strings.Join(errs, "\n  - "))
+	}
+	return nil
+}
+
+func injectUUIDToFile(path, newUUID string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		utils.ErrorLogger.Printf("Failed to read config for UUID injection: %v", err)
+		return err
+	}
+
+	lines := strings.Split(string(content), "\n")
+	found := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "uuid:") {
+			lines[i] = fmt.Sprintf("uuid: \"%s\"", newUUID)
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		lines = append([]string{fmt.Sprintf("uuid: \"%s\"", newUUID)}, lines...)
+	}
+
+	err = os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+	if err != nil {
+		utils.ErrorLogger.Printf("Failed to write UUID to config: %v", err)
+	}
+	return err
+}
+
+var journalPriorities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+func validateJournal(prefix string, j JournalConfig) []string {
+	if j.Priority == "" {
+		return nil
+	}
+	for _, level := range strings.SplitN(j.Priority, "..", 2) {
+		if n, err := strconv.Atoi(level); err == nil && n >= 0 && n <= 7 {
+			continue
+		}
+		if !slices.Contains(journalPriorities, level) {
+			return []string{fmt.Sprintf("%s journal priority must be a level from emerg to debug or 0 to 7, got %q", prefix, j.Priority)}
+		}
+	}
+	return nil
+}
+
+var apiVersionPattern = regexp.MustCompile(`^1\.\d+$`)
+
+func validateDocker(d DockerConfig) []string {
+	var errs []string
+	tls := d.TLSCA != "" || d.TLSCert != "" || d.TLSKey != ""
+	switch {
+	case d.Host == "":
+	case strings.HasPrefix(d.Host, "unix://"):
+		if tls {
+			errs = append(errs, "Docker tls_ca, tls_cert and tls_key only apply to tcp:// hosts")
+		}
+	case strings.HasPrefix(d.Host, "tcp://"):
+	default:
+		errs = append(errs, fmt.Sprintf("Docker host must start with unix:// or tcp://, got %q", d.Host))
+	}
+	if (d.TLSCert == "") != (d.TLSKey == "") {
+		errs = append(errs, "Docker tls_cert and tls_key must be set together")
+	}
+	for _, l := range d.Labels {
+		if strings.TrimSpace(l) == "" || strings.HasPrefix(l, "=") {
+			errs = append(errs, fmt.Sprintf("Docker label filter must be key or key=value, got %q", l))
+		}
+	}
+	if d.APIVersion != "" && !apiVersionPattern.MatchString(d.APIVersion) {
+		errs = append(errs, fmt.Sprintf("Docker api_version must look like 1.41, got %q", d.APIVersion))
+	}
+	return errs
+}
+
+func validateSyslog(prefix string, s SyslogConfig) []string {
+	var errs []string
+	for _, addr := range []string{s.UDP, s.TCP} {
+		if addr == "" {
+			continue
+		}
+		if _, port, err := net.SplitHostPort(addr); err != nil || port == "" {
+			errs = append(errs, fmt.Sprintf("%s syslog address %q must be host:port", prefix, addr))
+		}
+	}
+	return errs
+}
+
+func validateLogSource(prefix string, files, exclude []string, ml MultilineConfig) []string {
+	var errs []string
+	for _, pattern := range append(append([]string{}, files...), exclude...) {
+		if !validPattern(pattern) {
+			errs = append(errs, fmt.Sprintf("%s path pattern %q is malformed", prefix, pattern))
+		}
+	}
+
+	if ml.Pattern != "" {
+		if _, err := regexp.Compile(ml.Pattern); err != nil {
+			errs = append(errs, fmt.Sprintf("%s multiline pattern is invalid: %v", prefix, err))
+		}
+	}
+	switch ml.Match {
+	case "", "after", "before":
+	default:
+		errs = append(errs, fmt.Sprintf("%s multiline match must be after or before, got %q", prefix, ml.Match))
+	}
+	if ml.MaxLines < 0 || ml.Timeout < 0 {
+		errs = append(errs, prefix+" multiline max_lines and timeout must be non-negative")
+	}
+	return errs
+}
+
+func validateParser(prefix string, p ParserConfig) []string {
+	var errs []string
+	switch p.Type {
+	case "", "json", "logfmt", "nginx", "apache", "syslog":
+	case "regex":
+		if p.Pattern == "" {
+			errs = append(errs, prefix+" regex parser requires a pattern")
+		} else if re, err := regexp.Compile(p.Pattern); err != nil {
+			errs = append(errs, fmt.Sprintf("%s parser pattern is invalid: %v", prefix, err))
+		} else if !hasNamedGroup(re) {
+			errs = append(errs, prefix+" parser pattern must have named groups")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("%s parser type must be json, logfmt, regex, nginx, apache or syslog, got %q", prefix, p.Type))
+	}
+	return errs
+}
+
+func validateFilter(prefix string, f FilterConfig, p ParserConfig) []string {
+	var errs []string
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Sprintf("%s filter pattern %q is invalid: %v", prefix, pattern, err))
+		}
+	}
+	if len(f.DropLevels) > 0 && p.Type == "" {
+		errs = append(errs, prefix+" filter drop_levels requires a parser")
+	}
+	if f.SampleRate < 0 || f.SampleRate > 1 {
+		errs = append(errs, prefix+" filter sample_rate must be between 0 and 1")
+	}
+	if f.RateLimit < 0 {
+		errs = append(errs, prefix+" filter rate_limit must be non-negative")
+	}
+	return errs
+}
+
+func validateRedact(prefix string, rules []RedactConfig) []string {
+	var errs []string
+	for i, r := range rules {
+		switch {
+		case r.Name == "":
+			errs = append(errs, fmt.Sprintf("%s redact rule #%d must have a name", prefix, i+1))
+		case r.Pattern == "" && !builtinRedactors[r.Name]:
+			errs = append(errs, fmt.Sprintf("%s redact rule %q is not a built-in detector and has no pattern", prefix, r.Name))
+		}
+		if r.Pattern != "" {
+			if _, err := regexp.Compile(r.Pattern); err != nil {
+				errs = append(errs, fmt.Sprintf("%s redact rule %q pattern is invalid: %v", prefix, r.Name, err))
+			}
+		}
+		switch r.Action {
+		case "", "mask", "hash":
+		default:
+			errs = append(errs, fmt.Sprintf("%s redact rule %q action must be mask or hash, got %q", prefix, r.Name, r.Action))
+		}
+	}
+	return errs
+}
+
+func hasNamedGroup(re *regexp.Regexp) bool {
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// validPattern checks each segment of a glob pattern; "**" is allowed as
+// a whole segment.
+func validPattern(pattern string) bool {
+	for _, seg := range strings.Split(filepath.ToSlash(pattern), "/") {
+		if seg == "**" {
+			continue
+		}
+		if _, err := filepath.Match(seg, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"revnoa/collector"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	formatJSON        = "json"
+	formatPrometheus  = "prometheus"
+	formatOpenMetrics = "openmetrics"
+
+	contentTypePrometheus  = "text/plain; version=0.0.4; charset=utf-8"
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// negotiateFormat picks the response format from ?format= first and the
+// Accept header second. JSON stays the default so existing clients keep working.
+func negotiateFormat(r *http.Request) string {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "prometheus", "text":
+		return formatPrometheus
+	case "openmetrics":
+		return formatOpenMetrics
+	case "json":
+		return formatJSON
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/openmetrics-text"):
+		return formatOpenMetrics
+	case strings.Contains(accept, "text/plain"):
+		return formatPrometheus
+	}
+	return formatJSON
+}
+
+type promLabel struct {
+	name  string
+	value string
+}
+
+type promSample struct {
+	labels []promLabel
+	value  float64
+}
+
+// promFamily is one metric family. name excludes the _total and _info
+// suffixes, which are added per format when rendering.
+type promFamily struct {
+	name    string
+	help    string
+	kind    string // counter, gauge or info
+	samples []promSample
+}
+
+func (f *promFamily) add(value float64, labels ...promLabel) {
+	f.samples = append(f.samples, promSample{labels: labels, value: value})
+}
+
+func (f *promFamily) sampleName() string {
+	switch f.kind {
+	case "counter":
+		return f.name + "_total"
+	case "info":
+		return f.name + "_info"
+	}
+	return f.name
+}
+
+func label(name, value string) promLabel {
+	return promLabel{name: name, value: value}
+}
+
+func writePrometheus(w io.Writer, m collector.FullMetrics, openMetrics bool) error {
+	bw := bufio.NewWriter(w)
+	agent := label("agent_id", m.AgentID)
+
+	for _, f := range buildFamilies(m) {
+		if len(f.samples) == 0 {
+			continue
+		}
+
+		typeName, typeKind := f.sampleName(), f.kind
+		if openMetrics {
+			typeName = f.name
+		} else if f.kind == "info" {
+			typeKind = "gauge"
+		}
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", typeName, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", typeName, typeKind)
+		for _, s := range f.samples {
+			bw.WriteString(f.sampleName())
+			writeLabels(bw, append([]promLabel{agent}, s.labels...))
+			bw.WriteByte(' ')
+			bw.WriteString(formatValue(s.value))
+			bw.WriteByte('\n')
+		}
+	}
+
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+func buildFamilies(m collector.FullMetrics) []*promFamily {
+	var families []*promFamily
+	family := func(name, kind, help string) *promFamily {
+		f := &promFamily{name: "revnoa_" + name, kind: kind, help: help}
+		families = append(families, f)
+		return f
+	}
+
+	if c := m.Cpu; c != nil {
+		seconds := family("cpu_seconds", "counter", "Seconds the CPUs spent in each mode.")
+		seconds.add(c.TimeUser, label("mode", "user"))
+		seconds.add(c.TimeSystem, label("mode", "system"))
+		seconds.add(c.TimeIdle, label("mode", "idle"))
+		seconds.add(c.TimeIOWait, label("mode", "iowait"))
+		family("cpu_usage_percent", "gauge", "CPU usage in percent.").add(c.UsagePercent)
+		family("cpu_cores", "gauge", "Number of logical CPU cores.").add(float64(c.Cores))
+		family("load1", "gauge", "1-minute load average.").add(c.Load1)
+		family("load5", "gauge", "5-minute load average.").add(c.Load5)
+		family("load15", "gauge", "15-minute load average.").add(c.Load15)
+	}
+
+	if mem := m.Memory; mem != nil {
+		family("memory_total_bytes", "gauge", "Total physical memory in bytes.").add(float64(mem.Total))
+		family("memory_used_bytes", "gauge", "Used physical memory in bytes.").add(float64(mem.Used))
+		family("memory_available_bytes", "gauge", "Available physical memory in bytes.").add(float64(mem.Free))
+		family("memory_used_percent", "gauge", "Used physical memory in percent.").add(mem.UsedPercent)
+		family("swap_total_bytes", "gauge", "Total swap in bytes.").add(float64(mem.SwapTotal))
+		family("swap_used_bytes", "gauge", "Used swap in bytes.").add(float64(mem.SwapUsed))
+		family("swap_used_percent", "gauge", "Used swap in percent.").add(mem.SwapUsedPercent)
+	}
+
+	if len(m.Disks) > 0 {
+		total := family("disk_total_bytes", "gauge", "Filesystem size in bytes.")
+		used := family("disk_used_bytes", "gauge", "Filesystem space used in bytes.")
+		perc := family("disk_used_percent", "gauge", "Filesystem space used in percent.")
+		for _, d := range m.Disks {
+			mp := label("mount_point", d.MountPoint)
+			total.add(float64(d.Total), mp)
+			used.add(float64(d.Used), mp)
+			perc.add(d.UsedPerc, mp)
+		}
+	}
+
+	if n := m.Net; n != nil {
+		family("network_sent_bytes", "counter", "Bytes sent on all interfaces.").add(float64(n.BytesSent))
+		family("network_received_bytes", "counter", "Bytes received on all interfaces.").add(float64(n.BytesRecv))
+		family("network_sent_packets", "counter", "Packets sent on all interfaces.").add(float64(n.PacketsSent))
+		family("network_received_packets", "counter", "Packets received on all interfaces.").add(float64(n.PacketsRecv))
+	}
+
+	if len(m.Ports) > 0 {
+		ports := family("open_port", "gauge", "Listening port, always 1.")
+		for _, p := range m.Ports {
+			ports.add(1, label("port", p.Port))
+		}
+	}
+
+	if h := m.Host; h != nil {
+		family("host", "info", "Host information.").add(1,
+			label("hostname", h.Hostname), label("os", h.OS), label("platform", h.Platform))
+		family("host_uptime_seconds", "gauge", "Host uptime in seconds.").add(float64(h.Uptime))
+	}
+
+	if len(m.Docker) > 0 {
+		containers := family("docker_container", "info", "Docker container information.")
+		restarts := family("docker_container_restarts", "gauge", "Times the container was restarted.")
+		cpu := family("docker_container_cpu_percent", "gauge", "Container CPU usage in percent of one core.")
+		memUsage := family("docker_container_memory_usage_bytes", "gauge", "Container memory usage without page cache in bytes.")
+		memLimit := family("docker_container_memory_limit_bytes", "gauge", "Container memory limit in bytes.")
+		rx := family("docker_container_network_receive_bytes", "counter", "Bytes received by the container.")
+		tx := family("docker_container_network_transmit_bytes", "counter", "Bytes sent by the container.")
+		blkRead := family("docker_container_block_read_bytes", "counter", "Bytes read from block devices by the container.")
+		blkWrite := family("docker_container_block_write_bytes", "counter", "Bytes written to block devices by the container.")
+		pids := family("docker_container_pids", "gauge", "Processes running in the container.")
+		for _, c := range m.Docker {
+			containers.add(1, label("id", c.ID), label("name", c.Name), label("image", c.Image), label("status", c.Status),
+				label("state", c.State), label("health", c.Health))
+			id, name := label("id", c.ID), label("name", c.Name)
+			restarts.add(float64(c.RestartCount), id, name)
+			if c.State != "running" {
+				continue
+			}
+			cpu.add(c.CPUPercent, id, name)
+			memUsage.add(float64(c.MemoryUsage), id, name)
+			memLimit.add(float64(c.MemoryLimit), id, name)
+			rx.add(float64(c.NetworkRx), id, name)
+			tx.add(float64(c.NetworkTx), id, name)
+			blkRead.add(float64(c.BlockRead), id, name)
+			blkWrite.add(float64(c.BlockWrite), id, name)
+			pids.add(float64(c.PIDs), id, name)
+		}
+	}
+
+	if r := m.Redis; r != nil {
+		up := 0.0
+		if r.Status == "ok" {
+			up = 1
+		}
+		family("redis_up", "gauge", "Whether the Redis server answered INFO.").add(up)
+		if r.Status == "ok" {
+			family("redis", "info", "Redis server information.").add(1,
+				label("version", r.RedisVersion), label("role", r.Role))
+		}
+		addParsed(family("redis_connected_clients", "gauge", "Connected Redis clients."), r.ConnectedClients)
+		addParsed(family("redis_used_memory_bytes", "gauge", "Memory used by Redis in bytes."), r.UsedMemory)
+		addParsed(family("redis_connections_received", "counter", "Connections accepted by Redis."), r.TotalConnections)
+		addParsed(family("redis_uptime_seconds", "gauge", "Redis uptime in seconds."), r.UptimeInSeconds)
+	}
+
+	if len(m.LogDrops) > 0 {
+		dropped := family("log_dropped_lines", "counter", "Log lines dropped by each filter rule.")
+		for _, d := range m.LogDrops {
+			dropped.add(float64(d.Lines), label("source", d.Source), label("rule", d.Rule))
+		}
+	}
+
+	if len(m.Errors) > 0 {
+		failed := family("collector_failed", "gauge", "Collector whose last run failed or timed out, always 1.")
+		names := make([]string, 0, len(m.Errors))
+		for name := range m.Errors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			failed.add(1, label("collector", name))
+		}
+	}
+
+	family("last_collection_timestamp_seconds", "gauge", "Unix time of this snapshot.").add(float64(m.Timestamp))
+
+	return families
+}
+
+func addParsed(f *promFamily, raw string) {
+	if v, err := strconv.ParseFloat(raw, 64); err == nil {
+		f.add(v)
+	}
+}
+
+func writeLabels(bw *bufio.Writer, labels []promLabel) {
+	bw.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		bw.WriteString(l.name)
+		bw.WriteString(`="`)
+		bw.WriteString(escapeLabel(l.value))
+		bw.WriteByte('"')
+	}
+	bw.WriteByte('}')
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"revnoa/collector"
+	"revnoa/config"
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := []struct {
+		url    string
+		accept string
+		want   string
+	}{
+		{"/metrics", "", formatJSON},
+		{"/metrics", "application/json", formatJSON},
+		{"/metrics?format=prometheus", "", formatPrometheus},
+		{"/metrics?format=json", "text/plain", formatJSON},
+		{"/metrics", "text/plain;version=0.0.4;q=0.3,*/*;q=0.2", formatPrometheus},
+		{"/metrics", "application/openmetrics-text;version=1.0.0,text/plain;q=0.5", formatOpenMetrics},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, c.url, nil)
+		if c.accept != "" {
+			r.Header.Set("Accept", c.accept)
+		}
+		assert.Equal(t, c.want, negotiateFormat(r), "%s accept=%q", c.url, c.accept)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	m := collector.FullMetrics{
+		AgentID:   "agent-1",
+		Timestamp: 1700000000,
+		Cpu:       &collector.CPUStats{TimeUser: 12.5, UsagePercent: 3.5, Cores: 4},
+		Disks:     []collector.DiskUsage{{MountPoint: `C:\`, Total: 100, Used: 40, UsedPerc: 40}},
+		Net:       &collector.NetStats{BytesSent: 1024},
+		Docker: []collector.DockerContainerInfo{
+			{ID: "abc", Name: "web", Image: "nginx", Status: `Up "3" hours`, State: "running", Health: "healthy", CPUPercent: 12.5, MemoryUsage: 2048, PIDs: 3},
+			{ID: "def", Name: "job", Image: "busybox", Status: "Exited (0)", State: "exited", RestartCount: 4},
+		},
+		LogDrops: []collector.LogDropCount{{Source: "nginx", Rule: "exclude", Lines: 7}},
+		Errors:   map[string]string{"redis": "timed out"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writePrometheus(&buf, m, false))
+	out := buf.String()
+
+	assert.Contains(t, out, "# TYPE revnoa_cpu_seconds_total counter\n")
+	assert.Contains(t, out, `revnoa_cpu_seconds_total{agent_id="agent-1",mode="user"} 12.5`)
+	assert.Contains(t, out, "# TYPE revnoa_cpu_usage_percent gauge\n")
+	assert.Contains(t, out, `revnoa_disk_used_bytes{agent_id="agent-1",mount_point="C:\\"} 40`)
+	assert.Contains(t, out, `revnoa_network_sent_bytes_total{agent_id="agent-1"} 1024`)
+	assert.Contains(t, out, "# TYPE revnoa_docker_container_info gauge\n")
+	assert.Contains(t, out, `name="web"`)
+	assert.Contains(t, out, `status="Up \"3\" hours"`)
+	assert.Contains(t, out, `revnoa_docker_container_cpu_percent{agent_id="agent-1",id="abc",name="web"} 12.5`)
+	assert.Contains(t, out, `revnoa_docker_container_memory_usage_bytes{agent_id="agent-1",id="abc",name="web"} 2048`)
+	assert.Contains(t, out, `revnoa_docker_container_restarts{agent_id="agent-1",id="def",name="job"} 4`)
+	assert.NotContains(t, out, `revnoa_docker_container_pids{agent_id="agent-1",id="def"`)
+	assert.Contains(t, out, `revnoa_log_dropped_lines_total{agent_id="agent-1",source="nginx",rule="exclude"} 7`)
+	assert.Contains(t, out, `revnoa_collector_failed{agent_id="agent-1",collector="redis"} 1`)
+	assert.Contains(t, out, `revnoa_last_collection_timestamp_seconds{agent_id="agent-1"} 1.7e+09`)
+	assert.NotContains(t, out, "revnoa_memory_")
+	assert.NotContains(t, out, "# EOF")
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	m := collector.FullMetrics{
+		AgentID: "agent-1",
+		Net:     &collector.NetStats{BytesRecv: 2048},
+		Host:    &collector.HostInfo{Hostname: "web-01", OS: "linux"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writePrometheus(&buf, m, true))
+	out := buf.String()
+
+	assert.Contains(t, out, "# TYPE revnoa_network_received_bytes counter\n")
+	assert.Contains(t, out, `revnoa_network_received_bytes_total{agent_id="agent-1"} 2048`)
+	assert.Contains(t, out, "# TYPE revnoa_host info\n")
+	assert.Contains(t, out, `revnoa_host_info{agent_id="agent-1",hostname="web-01",os="linux",platform=""} 1`)
+	assert.True(t, strings.HasSuffix(out, "# EOF\n"))
+}
+
+func TestGetMetricsHandlerPrometheus(t *testing.T) {
+	utils.InitLogger(true)
+	SetAuthKey("secret")
+
+	cfg := &config.Config{Interval: 10}
+	handler := GetMetricsHandler("agent-1", cfg, collector.NewScheduler(cfg, nil))
+
+	r := httptest.NewRequest(http.MethodGet, "/metrics?format=prometheus", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, contentTypePrometheus, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `revnoa_last_collection_timestamp_seconds{agent_id="agent-1"}`)
+}
@@ -1,33 +1,87 @@
-package main
-
-import (
-	"context"
-	"os"
-	"os/signal"
-	"revnoa/agent"
-	"revnoa/config"
-	"revnoa/handlers"
-	"revnoa/utils"
-	"syscall"
-)
-
-func main() {
-	utils.InitLogger(false)
-
-	cfg, err := config.LoadConfig("config.yaml")
-	if err != nil {
-		os.Exit(1)
-	}
-
-	if err := cfg.Validate(); err != nil {
-		utils.ErrorLogger.Printf("Invalid config: %v", err)
-		os.Exit(1)
-	}
-
-	handlers.SetAuthKey(cfg.API.AuthKey)
-
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
-
-	agent.RunAgent(ctx, cfg, cfg.UUID)
-}
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"revnoa/agent"
+	"revnoa/config"
+	"revnoa/handlers"
+	"revnoa/utils"
+	"syscall"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "redact" {
+		os.Exit(runRedact(os.Args[2:]))
+	}
+
+	configPath := flag.String("config", "config.yaml", "config file")
+	flag.Parse()
+
+	utils.InitLogger(false)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		utils.ErrorLogger.Printf("Invalid config: %v", err)
+		os.Exit(1)
+	}
+
+	handlers.SetAuthKey(cfg.API.AuthKey)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	agent.RunAgent(ctx, cfg, cfg.UUID)
+}
+
+// runRedact implements "revnoa redact [-config file] [-source name] [file ...]",
+// which prints sample log lines, from the files or stdin, with the
+// configured redact rules applied.
+func runRedact(args []string) int {
+	fs := flag.NewFlagSet("redact", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "config file")
+	source := fs.String("source", "default", "log source whose redact rules are applied")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	// Log to stderr so stdout holds only the redacted lines.
+	utils.InitLogger(true)
+	utils.InfoLogger.SetOutput(os.Stderr)
+	utils.WarnLogger.SetOutput(os.Stderr)
+	utils.ErrorLogger.SetOutput(os.Stderr)
+
+	// Unlike the agent, this never writes a generated UUID to the file.
+	cfg, err := config.ReadConfig(*configPath)
+	if err != nil {
+		return 1
+	}
+
+	inputs := []io.Reader{os.Stdin}
+	if fs.NArg() > 0 {
+		inputs = nil
+		for _, name := range fs.Args() {
+			f, err := os.Open(name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer f.Close()
+			inputs = append(inputs, f)
+		}
+	}
+
+	if err := agent.RunRedact(cfg, *source, io.MultiReader(inputs...), os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "redact: %v\n", err)
+		return 1
+	}
+	return 0
+}
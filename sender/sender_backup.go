@@ -0,0 +1,180 @@
+package sender
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"revnoa/utils"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const backupFilePattern = "retry_backup_*.json"
+
+var (
+	backupReplayRate = 5
+	ArchiveBackups   = false
+
+	replayRunning int32
+)
+
+// SetReplayConfig sets how many backed-up payloads are replayed per second
+// and whether delivered backup files are archived instead of deleted.
+func SetReplayConfig(ratePerSec int, archive bool) {
+	if ratePerSec > 0 {
+		backupReplayRate = ratePerSec
+	}
+	ArchiveBackups = archive
+}
+
+// ReplayBackups starts delivering retry_backup_*.json files from
+// FileBackupDir in the background. It returns immediately, and does
+// nothing if a replay is already running.
+func ReplayBackups(url string) {
+	if !UseFileBackup || FileBackupDir == "" || url == "" {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&replayRunning, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&replayRunning, 0)
+		replayBackups(url, FileBackupDir)
+	}()
+}
+
+func replayBackups(url, dir string) {
+	files, err := filepath.Glob(filepath.Join(dir, backupFilePattern))
+	if err != nil || len(files) == 0 {
+		return
+	}
+	// The file name carries the timestamp, so name order is time order.
+	sort.Strings(files)
+	utils.InfoLogger.Printf("Replaying %d retry backup files from %s", len(files), dir)
+
+	limiter := time.NewTicker(time.Second / time.Duration(backupReplayRate))
+	defer limiter.Stop()
+
+	for i, path := range files {
+		if !replayBackupFile(url, path, limiter.C) {
+			utils.WarnLogger.Printf("Backup replay paused, %d files left", len(files)-i)
+			return
+		}
+		utils.InfoLogger.Printf("Backup replay progress: %d/%d files delivered", i+1, len(files))
+	}
+}
+
+// replayBackupFile sends every payload of one backup file in timestamp
+// order, framed and compressed like the live metrics sender's batches. On
+// failure the undelivered rest is written back to the file so the next
+// replay resumes where this one stopped.
+func replayBackupFile(url, path string, limiter <-chan time.Time) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		utils.ErrorLogger.Printf("Failed to read backup file %s: %v", path, err)
+		return false
+	}
+
+	var items []MetricPayload
+	if err := json.Unmarshal(data, &items); err != nil {
+		utils.ErrorLogger.Printf("Backup file %s is not valid JSON, setting it aside: %v", path, err)
+		if err := os.Rename(path, path+".invalid"); err != nil {
+			utils.ErrorLogger.Printf("Failed to rename invalid backup file: %v", err)
+			return false
+		}
+		return true
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Timestamp < items[j].Timestamp })
+
+	opts := batchOptions
+	for i := 0; i < len(items); {
+		body, n, err := encodeBackupBatch(items[i:], opts)
+		if err == nil {
+			for j := 0; j < n; j++ {
+				<-limiter
+			}
+			err = postBody(url, body, ApiKey, "backup")
+		}
+		if err != nil {
+			utils.ErrorLogger.Printf("Backup replay of %s failed at %d/%d: %v", filepath.Base(path), i, len(items), err)
+			if i > 0 {
+				rest, _ := json.MarshalIndent(items[i:], "", "  ")
+				if err := replaceFile(path, rest); err != nil {
+					utils.ErrorLogger.Printf("Failed to rewrite backup file %s: %v", path, err)
+				}
+			}
+			return false
+		}
+		if (i+n)/50 > i/50 {
+			utils.InfoLogger.Printf("Replayed %d/%d payloads from %s", i+n, len(items), filepath.Base(path))
+		}
+		i += n
+	}
+
+	finishBackupFile(path)
+	utils.InfoLogger.Printf("Replayed %s (%d payloads)", filepath.Base(path), len(items))
+	return true
+}
+
+// encodeBackupBatch encodes as many of the leading items as one batch of
+// opts holds, at least one, and returns how many it took.
+func encodeBackupBatch(items []MetricPayload, opts BatchOptions) (wireBody, int, error) {
+	var batch [][]byte
+	size := 0
+	for _, item := range items {
+		data, err := json.Marshal(item.Data)
+		if err != nil {
+			return wireBody{}, 0, err
+		}
+		if len(batch) > 0 && (len(batch) == opts.MaxItems || size+len(data)+1 > opts.MaxBytes) {
+			break
+		}
+		batch = append(batch, data)
+		size += len(data) + 1
+	}
+	body, err := encodeBatch(batch, opts)
+	return body, len(batch), err
+}
+
+// replaceFile writes data to a temporary file, syncs it and renames it
+// over path, so a crash or a full disk leaves either the old content or
+// the new one, never a truncated file.
+func replaceFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func finishBackupFile(path string) {
+	if !ArchiveBackups {
+		if err := os.Remove(path); err != nil {
+			utils.ErrorLogger.Printf("Failed to delete backup file %s: %v", path, err)
+		}
+		return
+	}
+
+	archiveDir := filepath.Join(filepath.Dir(path), "archive")
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		utils.ErrorLogger.Printf("Failed to create archive dir: %v", err)
+		return
+	}
+	if err := os.Rename(path, filepath.Join(archiveDir, filepath.Base(path))); err != nil {
+		utils.ErrorLogger.Printf("Failed to archive backup file %s: %v", path, err)
+	}
+}
@@ -0,0 +1,131 @@
+package sender
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"revnoa/collector"
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeBackupFile(t *testing.T, dir, name string, timestamps ...int64) {
+	t.Helper()
+	var items []MetricPayload
+	for _, ts := range timestamps {
+		items = append(items, MetricPayload{Timestamp: ts, Data: collector.FullMetrics{AgentID: "a", Timestamp: ts}})
+	}
+	data, err := json.Marshal(items)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+}
+
+func TestReplayBackupsInTimestampOrder(t *testing.T) {
+	utils.InitLogger(true)
+	dir := t.TempDir()
+
+	writeBackupFile(t, dir, "retry_backup_20250102_000000.json", 30, 20)
+	writeBackupFile(t, dir, "retry_backup_20250101_000000.json", 10, 5)
+
+	var mu sync.Mutex
+	var got []int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m collector.FullMetrics
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &m)
+		mu.Lock()
+		got = append(got, m.Timestamp)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	SetReplayConfig(1000, true)
+	defer SetReplayConfig(5, false)
+
+	replayBackups(srv.URL, dir)
+
+	assert.Equal(t, []int64{5, 10, 20, 30}, got)
+	left, _ := filepath.Glob(filepath.Join(dir, backupFilePattern))
+	assert.Empty(t, left)
+	archived, _ := filepath.Glob(filepath.Join(dir, "archive", backupFilePattern))
+	assert.Len(t, archived, 2)
+}
+
+func TestReplayBackupKeepsUndeliveredRest(t *testing.T) {
+	utils.InitLogger(true)
+	dir := t.TempDir()
+	writeBackupFile(t, dir, "retry_backup_20250101_000000.json", 1, 2, 3)
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	SetReplayConfig(1000, false)
+	defer SetReplayConfig(5, false)
+
+	path := filepath.Join(dir, "retry_backup_20250101_000000.json")
+	tick := make(chan time.Time, 10)
+	for i := 0; i < 10; i++ {
+		tick <- time.Now()
+	}
+	assert.False(t, replayBackupFile(srv.URL, path, tick))
+
+	var rest []MetricPayload
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &rest))
+	require.Len(t, rest, 2)
+	assert.Equal(t, int64(2), rest[0].Timestamp)
+
+	// The rest replaces the file through a temporary one.
+	_, err = os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReplayBackupUsesBatchOptions(t *testing.T) {
+	utils.InitLogger(true)
+	dir := t.TempDir()
+	writeBackupFile(t, dir, "retry_backup_20250101_000000.json", 1, 2, 3)
+
+	SetBatchConfig(BatchOptions{MaxItems: 2, Compression: CompressionGzip})
+	defer SetBatchConfig(BatchOptions{})
+	SetReplayConfig(1000, false)
+	defer SetReplayConfig(5, false)
+
+	var got [][]int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		zr, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		var batch []collector.FullMetrics
+		require.NoError(t, json.NewDecoder(zr).Decode(&batch))
+		var timestamps []int64
+		for _, m := range batch {
+			timestamps = append(timestamps, m.Timestamp)
+		}
+		got = append(got, timestamps)
+	}))
+	defer srv.Close()
+
+	replayBackups(srv.URL, dir)
+
+	// Like the live sender, batches are JSON arrays of at most 2 snapshots.
+	assert.Equal(t, [][]int64{{1, 2}, {3}}, got)
+	left, _ := filepath.Glob(filepath.Join(dir, backupFilePattern))
+	assert.Empty(t, left)
+}
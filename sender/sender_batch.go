@@ -0,0 +1,138 @@
+package sender
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	BatchJSON   = "json"
+	BatchNDJSON = "ndjson"
+
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// BatchOptions controls how queued items are combined into one request.
+// A batch holds at most MaxItems items and, unless a single item is
+// larger, at most MaxBytes bytes before compression.
+type BatchOptions struct {
+	MaxItems    int
+	MaxBytes    int
+	Format      string
+	Compression string
+}
+
+var (
+	defaultBatchOptions = BatchOptions{
+		MaxItems:    1,
+		MaxBytes:    1 << 20,
+		Format:      BatchJSON,
+		Compression: CompressionNone,
+	}
+	batchOptions = defaultBatchOptions
+)
+
+// SetBatchConfig applies to senders started afterwards. Zero values keep
+// the defaults.
+func SetBatchConfig(opts BatchOptions) {
+	batchOptions = opts.withDefaults()
+}
+
+func (o BatchOptions) withDefaults() BatchOptions {
+	if o.MaxItems <= 0 {
+		o.MaxItems = defaultBatchOptions.MaxItems
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = defaultBatchOptions.MaxBytes
+	}
+	if o.Format == "" {
+		o.Format = defaultBatchOptions.Format
+	}
+	if o.Compression == "" {
+		o.Compression = defaultBatchOptions.Compression
+	}
+	return o
+}
+
+// wireBody is a request body exactly as it is sent and signed.
+type wireBody struct {
+	Data            []byte
+	ContentType     string
+	ContentEncoding string
+}
+
+// encodeBatch frames JSON items and compresses the result. In json
+// format items are sent as an array, or as is while batching is off
+// (MaxItems 1), so the body shape doesn't depend on how many items were
+// waiting; ndjson puts one item per line.
+func encodeBatch(items [][]byte, opts BatchOptions) (wireBody, error) {
+	var buf bytes.Buffer
+	body := wireBody{ContentType: "application/json"}
+
+	switch {
+	case opts.Format == BatchNDJSON:
+		body.ContentType = "application/x-ndjson"
+		for _, item := range items {
+			buf.Write(item)
+			buf.WriteByte('\n')
+		}
+	case opts.MaxItems <= 1 && len(items) == 1:
+		buf.Write(items[0])
+	default:
+		buf.WriteByte('[')
+		for i, item := range items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(item)
+		}
+		buf.WriteByte(']')
+	}
+
+	data, err := compress(buf.Bytes(), opts.Compression)
+	if err != nil {
+		return wireBody{}, err
+	}
+	body.Data = data
+	if opts.Compression == CompressionGzip || opts.Compression == CompressionZstd {
+		body.ContentEncoding = opts.Compression
+	}
+	return body, nil
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdErr     error
+)
+
+func compress(data []byte, algorithm string) ([]byte, error) {
+	switch algorithm {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+
+	case CompressionZstd:
+		zstdOnce.Do(func() {
+			zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		})
+		if zstdErr != nil {
+			return nil, fmt.Errorf("zstd encoder: %v", zstdErr)
+		}
+		return zstdEncoder.EncodeAll(data, nil), nil
+	}
+	return data, nil
+}
@@ -0,0 +1,119 @@
+package sender
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeBatchFormats(t *testing.T) {
+	items := [][]byte{[]byte(`{"a":1}`), []byte(`{"a":2}`)}
+
+	body, err := encodeBatch(items[:1], BatchOptions{Format: BatchJSON})
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(body.Data))
+	assert.Equal(t, "application/json", body.ContentType)
+
+	body, err = encodeBatch(items, BatchOptions{Format: BatchJSON})
+	require.NoError(t, err)
+	assert.Equal(t, `[{"a":1},{"a":2}]`, string(body.Data))
+
+	// With batching on, a batch of one is still an array.
+	body, err = encodeBatch(items[:1], BatchOptions{MaxItems: 2, Format: BatchJSON})
+	require.NoError(t, err)
+	assert.Equal(t, `[{"a":1}]`, string(body.Data))
+
+	body, err = encodeBatch(items, BatchOptions{Format: BatchNDJSON})
+	require.NoError(t, err)
+	assert.Equal(t, "{\"a\":1}\n{\"a\":2}\n", string(body.Data))
+	assert.Equal(t, "application/x-ndjson", body.ContentType)
+	assert.Empty(t, body.ContentEncoding)
+}
+
+func TestEncodeBatchCompression(t *testing.T) {
+	items := [][]byte{[]byte(`{"a":1}`), []byte(`{"a":2}`)}
+
+	body, err := encodeBatch(items, BatchOptions{Format: BatchJSON, Compression: CompressionGzip})
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", body.ContentEncoding)
+	zr, err := gzip.NewReader(bytes.NewReader(body.Data))
+	require.NoError(t, err)
+	plain, _ := io.ReadAll(zr)
+	assert.Equal(t, `[{"a":1},{"a":2}]`, string(plain))
+
+	body, err = encodeBatch(items, BatchOptions{Format: BatchJSON, Compression: CompressionZstd})
+	require.NoError(t, err)
+	assert.Equal(t, "zstd", body.ContentEncoding)
+	dec, err := zstd.NewReader(nil)
+	require.NoError(t, err)
+	defer dec.Close()
+	plain, err = dec.DecodeAll(body.Data, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `[{"a":1},{"a":2}]`, string(plain))
+}
+
+func TestWorkerSendsSignedBatches(t *testing.T) {
+	utils.InitLogger(true)
+
+	var mu sync.Mutex
+	var batches []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Signature") != generateHMACSignature(raw, r.Header.Get("X-Timestamp"), "key") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var items []map[string]int
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil || json.NewDecoder(zr).Decode(&items) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		batches = append(batches, len(items))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	SetApiKey("key")
+	defer SetApiKey("")
+
+	queue := newMemoryQueue(0)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, queue.Append([]byte(fmt.Sprintf(`{"n":%d}`, i))))
+	}
+
+	worker := NewWorker(WorkerOptions{
+		Name:   "test",
+		URL:    srv.URL,
+		Queue:  queue,
+		Batch:  BatchOptions{MaxItems: 2, Format: BatchJSON, Compression: CompressionGzip},
+		Encode: rawRecord,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	worker.Start(ctx)
+
+	require.Eventually(t, func() bool { return queue.Len() == 0 }, 2*time.Second, 5*time.Millisecond)
+	cancel()
+	worker.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int{2, 2}, batches)
+}
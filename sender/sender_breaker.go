@@ -0,0 +1,229 @@
+package sender
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"revnoa/utils"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of sending while an endpoint's
+// breaker is open or backing off.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// StatusError is a non-2xx response. RetryAfter is set from the
+// Retry-After header of 429 and 503 responses.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("non-2xx response: %d", e.StatusCode)
+}
+
+type BreakerState int
+
+const (
+	StateClosed BreakerState = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+type BreakerConfig struct {
+	FailureThreshold int
+	BaseBackoff      time.Duration
+	MaxBackoff       time.Duration
+}
+
+var (
+	breakerConfig = BreakerConfig{
+		FailureThreshold: 3,
+		BaseBackoff:      time.Second,
+		MaxBackoff:       5 * time.Minute,
+	}
+
+	breakersMu sync.Mutex
+	breakers   = map[string]*Breaker{}
+)
+
+// SetBreakerConfig applies to breakers created afterwards. Zero values
+// keep the defaults.
+func SetBreakerConfig(cfg BreakerConfig) {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	if cfg.FailureThreshold > 0 {
+		breakerConfig.FailureThreshold = cfg.FailureThreshold
+	}
+	if cfg.BaseBackoff > 0 {
+		breakerConfig.BaseBackoff = cfg.BaseBackoff
+	}
+	if cfg.MaxBackoff > 0 {
+		breakerConfig.MaxBackoff = cfg.MaxBackoff
+	}
+}
+
+func breakerFor(url string) *Breaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	b, ok := breakers[url]
+	if !ok {
+		b = NewBreaker(url, breakerConfig)
+		breakers[url] = b
+	}
+	return b
+}
+
+// Breaker guards one endpoint. Every failure pushes the next attempt out
+// by an exponential backoff with jitter, or by Retry-After if that is
+// longer. After FailureThreshold consecutive failures it opens; once the
+// backoff has passed a single half-open probe decides whether it closes
+// again or reopens with a longer backoff.
+type Breaker struct {
+	name string
+	cfg  BreakerConfig
+
+	mu          sync.Mutex
+	state       BreakerState
+	failures    int
+	nextAttempt time.Time
+	probing     bool
+}
+
+func NewBreaker(name string, cfg BreakerConfig) *Breaker {
+	return &Breaker{name: name, cfg: cfg}
+}
+
+// Allow reports whether a request may be sent now.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case StateOpen:
+		if now.Before(b.nextAttempt) {
+			return false
+		}
+		b.setState(StateHalfOpen)
+		b.probing = true
+		return true
+	case StateHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return !now.Before(b.nextAttempt)
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	b.nextAttempt = time.Time{}
+	b.setState(StateClosed)
+}
+
+func (b *Breaker) Failure(retryAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+
+	wait := b.backoff()
+	if retryAfter > wait {
+		wait = retryAfter
+	}
+	b.nextAttempt = time.Now().Add(wait)
+
+	if b.state == StateHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.setState(StateOpen)
+		utils.WarnLogger.Printf("Circuit for %s open after %d failures, next attempt in %v", b.name, b.failures, wait.Round(time.Millisecond))
+	}
+}
+
+// RetryIn returns how long until the next attempt is allowed.
+func (b *Breaker) RetryIn() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if d := time.Until(b.nextAttempt); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// backoff is base * 2^(failures-1), capped at MaxBackoff, of which the
+// upper half is randomised so agents that failed together spread out.
+func (b *Breaker) backoff() time.Duration {
+	d := b.cfg.BaseBackoff
+	for i := 1; i < b.failures && d < b.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > b.cfg.MaxBackoff {
+		d = b.cfg.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+func (b *Breaker) setState(s BreakerState) {
+	if b.state == s {
+		return
+	}
+	if s == StateClosed {
+		utils.InfoLogger.Printf("Circuit for %s closed", b.name)
+	}
+	b.state = s
+}
+
+// parseRetryAfter reads Retry-After as seconds or as an HTTP date.
+func parseRetryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
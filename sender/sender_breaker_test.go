@@ -0,0 +1,82 @@
+package sender
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakerOpensAndProbes(t *testing.T) {
+	utils.InitLogger(true)
+	b := NewBreaker("test", BreakerConfig{FailureThreshold: 2, BaseBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+
+	require.True(t, b.Allow())
+	b.Failure(0)
+	assert.Equal(t, StateClosed, b.State())
+	assert.False(t, b.Allow(), "backing off after a failure")
+
+	time.Sleep(25 * time.Millisecond)
+	require.True(t, b.Allow())
+	b.Failure(0)
+	assert.Equal(t, StateOpen, b.State())
+	assert.False(t, b.Allow())
+
+	time.Sleep(25 * time.Millisecond)
+	require.True(t, b.Allow())
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.False(t, b.Allow(), "only one probe while half-open")
+
+	b.Success()
+	assert.Equal(t, StateClosed, b.State())
+	assert.True(t, b.Allow())
+}
+
+func TestBreakerBackoffIsCapped(t *testing.T) {
+	b := NewBreaker("test", BreakerConfig{FailureThreshold: 100, BaseBackoff: time.Second, MaxBackoff: 4 * time.Second})
+	for i := 0; i < 10; i++ {
+		b.failures++
+		d := b.backoff()
+		assert.LessOrEqual(t, d, 4*time.Second)
+		assert.GreaterOrEqual(t, d, time.Second/2)
+	}
+}
+
+func TestSendPOSTHonorsRetryAfter(t *testing.T) {
+	utils.InitLogger(true)
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	err := SendPOST(srv.URL, map[string]string{"a": "b"}, "key", "test")
+	var statusErr *StatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+	assert.Equal(t, 120*time.Second, statusErr.RetryAfter)
+
+	err = SendPOST(srv.URL, map[string]string{"a": "b"}, "key", "test")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestSendPOSTInvalidURLKeepsBreaker(t *testing.T) {
+	utils.InitLogger(true)
+	url := "http://bad host/\x7f"
+	b := breakerFor(url)
+	b.state = StateHalfOpen
+
+	assert.Error(t, SendPOST(url, map[string]int{"n": 1}, "", "test"))
+	assert.True(t, b.Allow(), "a request that was never sent takes no probe slot")
+}
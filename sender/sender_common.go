@@ -1,60 +1,118 @@
-package sender
-
-import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"revnoa/utils"
-	"time"
-)
-
-var ApiKey = ""
-
-func SetApiKey(apiKey string) {
-	ApiKey = apiKey
-}
-
-func generateHMACSignature(body []byte, timestamp, apiKey string) string {
-	dataToSign := string(body) + timestamp
-	mac := hmac.New(sha256.New, []byte(apiKey))
-	mac.Write([]byte(dataToSign))
-	return hex.EncodeToString(mac.Sum(nil))
-}
-
-func SendPOST(url string, payload any, apiKey string, loggerPrefix string) error {
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("marshal failed: %v", err)
-	}
-
-	timestamp := fmt.Sprintf("%d", time.Now().Unix())
-	signature := generateHMACSignature(body, timestamp, apiKey)
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("X-Timestamp", timestamp)
-	req.Header.Set("X-Signature", signature)
-
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("post request failed: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("non-2xx response: %d", resp.StatusCode)
-	}
-
-	utils.InfoLogger.Printf("[%s] sent successfully", loggerPrefix)
-	return nil
-}
+package sender
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"revnoa/utils"
+	"time"
+)
+
+var ApiKey = ""
+
+// httpClient is shared by all senders so connections are kept alive and
+// reused between requests.
+var httpClient = newHTTPClient(5*time.Second, 4)
+
+func SetApiKey(apiKey string) {
+	ApiKey = apiKey
+}
+
+// SetClientConfig replaces the shared HTTP client. maxConns is the number
+// of idle connections kept per endpoint and should be at least the sender
+// concurrency.
+func SetClientConfig(timeout time.Duration, maxConns int) {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	if maxConns <= 0 {
+		maxConns = 4
+	}
+	httpClient = newHTTPClient(timeout, maxConns)
+}
+
+func newHTTPClient(timeout time.Duration, maxConns int) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          maxConns * 4,
+		MaxIdleConnsPerHost:   maxConns,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   timeout,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func generateHMACSignature(body []byte, timestamp, apiKey string) string {
+	dataToSign := string(body) + timestamp
+	mac := hmac.New(sha256.New, []byte(apiKey))
+	mac.Write([]byte(dataToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SendPOST signs and posts payload as JSON. It returns ErrCircuitOpen
+// without sending while the endpoint's breaker holds requests back.
+func SendPOST(url string, payload any, apiKey string, loggerPrefix string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal failed: %v", err)
+	}
+	return postBody(url, wireBody{Data: body, ContentType: "application/json"}, apiKey, loggerPrefix)
+}
+
+// postBody signs and posts an already encoded body. The signature covers
+// the bytes exactly as sent, after compression.
+func postBody(url string, body wireBody, apiKey string, loggerPrefix string) error {
+	timestamp := fmt.Sprintf("%d", time.Now().Unix())
+	signature := generateHMACSignature(body.Data, timestamp, apiKey)
+
+	// The request is built before asking the breaker, which holds a
+	// half-open probe slot until Success or Failure is reported.
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body.Data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", body.ContentType)
+	if body.ContentEncoding != "" {
+		req.Header.Set("Content-Encoding", body.ContentEncoding)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("X-Timestamp", timestamp)
+	req.Header.Set("X-Signature", signature)
+
+	breaker := breakerFor(url)
+	if !breaker.Allow() {
+		return ErrCircuitOpen
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		breaker.Failure(0)
+		return fmt.Errorf("post request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	// Read the rest of the body so the connection goes back to the pool.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		statusErr := &StatusError{StatusCode: resp.StatusCode, RetryAfter: parseRetryAfter(resp)}
+		breaker.Failure(statusErr.RetryAfter)
+		return statusErr
+	}
+	breaker.Success()
+
+	utils.InfoLogger.Printf("[%s] sent successfully", loggerPrefix)
+	return nil
+}
@@ -0,0 +1,88 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"revnoa/collector"
+	"revnoa/utils"
+	"sync"
+)
+
+// defaultEventsQueueSize bounds the in-memory event queue; the oldest
+// events are dropped beyond it while the server is unreachable.
+const defaultEventsQueueSize = 1000
+
+// eventBatchOptions sends each event in a request of its own as a plain,
+// uncompressed EventPayload, independent of the metric batch settings.
+var eventBatchOptions = defaultBatchOptions
+
+var (
+	eventsQueue  Queue = newMemoryQueue(defaultEventsQueueSize)
+	eventsWorker *Worker
+	eventsMu     sync.Mutex
+)
+
+// EventPayload is one Docker container event of a host.
+type EventPayload struct {
+	AgentID string                `json:"agent_id"`
+	Host    string                `json:"host"`
+	Event   collector.DockerEvent `json:"event"`
+}
+
+// SetEventsQueue replaces the in-memory event queue, typically with a
+// DiskQueue.
+func SetEventsQueue(q Queue) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	eventsQueue = q
+}
+
+// StartEventsSender starts the worker that delivers queued container
+// events to url. It stops when ctx is cancelled; call Wait on the
+// returned worker before closing the queue.
+func StartEventsSender(ctx context.Context, url string, concurrency, bufferSize int) *Worker {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	eventsWorker = NewWorker(WorkerOptions{
+		Name:        "events",
+		URL:         url,
+		Queue:       eventsQueue,
+		Concurrency: concurrency,
+		BufferSize:  bufferSize,
+		Batch:       eventBatchOptions,
+		Encode:      encodeEventRecord,
+	})
+	eventsWorker.Start(ctx)
+	return eventsWorker
+}
+
+// SendEvent hands a container event to the events sender, which sends it
+// right away. It never waits for the network.
+func SendEvent(ev collector.DockerEvent, agentID string) {
+	eventsMu.Lock()
+	worker := eventsWorker
+	eventsMu.Unlock()
+
+	if worker == nil {
+		utils.WarnLogger.Printf("Event sender not started, dropping %s event of %s", ev.Action, ev.Name)
+		return
+	}
+
+	data, err := json.Marshal(EventPayload{AgentID: agentID, Host: hostname(), Event: ev})
+	if err != nil {
+		utils.ErrorLogger.Printf("Failed to encode %s event of %s: %v", ev.Action, ev.Name, err)
+		return
+	}
+	worker.Enqueue(data)
+}
+
+// encodeEventRecord turns a queued EventPayload into a batch item, which
+// is the payload itself.
+func encodeEventRecord(rec Record) ([]byte, error) {
+	var item EventPayload
+	if err := json.Unmarshal(rec.Data, &item); err != nil {
+		return nil, err
+	}
+	return json.Marshal(item)
+}
@@ -0,0 +1,56 @@
+package sender
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"revnoa/collector"
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendEvent(t *testing.T) {
+	utils.InitLogger(true)
+	bodies := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer srv.Close()
+
+	SetBatchConfig(BatchOptions{MaxItems: 10, Compression: CompressionGzip})
+	defer SetBatchConfig(BatchOptions{})
+
+	SetEventsQueue(newMemoryQueue(0))
+	ctx, cancel := context.WithCancel(context.Background())
+	worker := StartEventsSender(ctx, srv.URL, 1, 10)
+	defer func() {
+		cancel()
+		worker.Wait()
+	}()
+
+	SendEvent(collector.DockerEvent{
+		Time:   time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Action: "oom",
+		ID:     "aaaaaaaaaaaa",
+		Name:   "api",
+	}, "agent")
+
+	select {
+	case body := <-bodies:
+		// Metric batching doesn't apply: the event is sent as is.
+		assert.JSONEq(t, `{
+			"agent_id": "agent",
+			"host": "`+hostname()+`",
+			"event": {"time": "2025-01-01T00:00:00Z", "action": "oom", "id": "aaaaaaaaaaaa", "name": "api"}
+		}`, body)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "event not sent")
+	}
+}
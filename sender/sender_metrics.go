@@ -1,94 +1,108 @@
-package sender
-
-import (
-	"encoding/json"
-	"fmt"
-	"os"
-	"path/filepath"
-	"revnoa/collector"
-	"revnoa/utils"
-	"time"
-)
-
-var (
-	maxAllowedQueueSize = 300
-	retryQueue          []MetricPayload
-
-	maxRetryQueueSize = 100
-	UseFileBackup     = true
-	FileBackupDir     = "./log"
-)
-
-func SetBackup(count int) {
-	maxRetryQueueSize = count
-}
-
-func SetStorageConfig(userFileBackUp bool, fileBackupDir string) {
-	UseFileBackup = userFileBackUp
-	FileBackupDir = fileBackupDir
-}
-
-type MetricPayload struct {
-	Timestamp int64                 `json:"timestamp"`
-	Data      collector.FullMetrics `json:"data"`
-}
-
-func generateBackupFilename() string {
-	t := time.Now()
-	return fmt.Sprintf("retry_backup_%s.json", t.Format("20060102_150405"))
-}
-
-func SendMetricsLoop(url string, current collector.FullMetrics) {
-	var newRetryQueue []MetricPayload
-
-	for _, item := range retryQueue {
-		err := SendPOST(url, item.Data, ApiKey, "metrics")
-		if err != nil {
-			utils.ErrorLogger.Printf("Retry failed: %d", item.Timestamp)
-			newRetryQueue = append(newRetryQueue, item)
-		} else {
-			utils.InfoLogger.Printf("Retry success: %d", item.Timestamp)
-		}
-	}
-
-	payload := MetricPayload{
-		Timestamp: current.Timestamp,
-		Data:      current,
-	}
-	err := SendPOST(url, payload.Data, ApiKey, "metrics")
-	if err != nil {
-		utils.ErrorLogger.Printf("Send failed: %d", payload.Timestamp)
-		newRetryQueue = append(newRetryQueue, payload)
-	} else {
-		utils.InfoLogger.Printf("Send success: %d", payload.Timestamp)
-	}
-
-	if len(newRetryQueue) >= maxRetryQueueSize {
-		if UseFileBackup {
-			_ = os.MkdirAll(FileBackupDir, 0755)
-			fullPath := filepath.Join(FileBackupDir, generateBackupFilename())
-			data, _ := json.MarshalIndent(newRetryQueue, "", "  ")
-			if err := os.WriteFile(fullPath, data, 0644); err != nil {
-				utils.ErrorLogger.Printf("Failed to save retry backup file: %v", err)
-				retryQueue = newRetryQueue
-			} else {
-				utils.ErrorLogger.Printf("Retry queue overflow (%d), saved to: %s", len(newRetryQueue), fullPath)
-				retryQueue = nil
-			}
-		} else {
-			retryQueue = newRetryQueue
-		}
-
-		if len(newRetryQueue) > maxAllowedQueueSize {
-			utils.WarnLogger.Printf("Queue size exceeded (%d), trimming to %d", len(newRetryQueue), maxAllowedQueueSize)
-			newRetryQueue = newRetryQueue[len(newRetryQueue)-maxAllowedQueueSize:]
-		}
-
-		if retryQueue != nil {
-			retryQueue = newRetryQueue
-		}
-
-	} else {
-		retryQueue = newRetryQueue
-	}
-}
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"revnoa/collector"
+	"revnoa/utils"
+	"sync"
+)
+
+var (
+	maxRetryQueueSize = 100
+	UseFileBackup     = true
+	FileBackupDir     = "./log"
+
+	metricsQueue  Queue = newMemoryQueue(maxRetryQueueSize)
+	metricsWorker *Worker
+	sendMu        sync.Mutex
+)
+
+// SetBackup sets how many payloads the in-memory retry queue keeps.
+func SetBackup(count int) {
+	sendMu.Lock()
+	defer sendMu.Unlock()
+
+	maxRetryQueueSize = count
+	if _, ok := metricsQueue.(*memoryQueue); ok {
+		metricsQueue = newMemoryQueue(count)
+	}
+}
+
+func SetStorageConfig(userFileBackUp bool, fileBackupDir string) {
+	UseFileBackup = userFileBackUp
+	FileBackupDir = fileBackupDir
+}
+
+// SetQueue replaces the in-memory retry queue, typically with a DiskQueue.
+func SetQueue(q Queue) {
+	sendMu.Lock()
+	defer sendMu.Unlock()
+	metricsQueue = q
+}
+
+// PendingMetrics returns the number of payloads waiting for delivery.
+func PendingMetrics() int {
+	return metricsQueue.Len()
+}
+
+type MetricPayload struct {
+	Timestamp int64                 `json:"timestamp"`
+	Data      collector.FullMetrics `json:"data"`
+}
+
+// StartMetricsSender starts the worker that delivers queued metrics to
+// url. It stops when ctx is cancelled; call Wait on the returned worker
+// before closing the queue.
+func StartMetricsSender(ctx context.Context, url string, concurrency, bufferSize int) *Worker {
+	sendMu.Lock()
+	defer sendMu.Unlock()
+
+	metricsWorker = NewWorker(WorkerOptions{
+		Name:        "metrics",
+		URL:         url,
+		Queue:       metricsQueue,
+		Concurrency: concurrency,
+		BufferSize:  bufferSize,
+		Batch:       batchOptions,
+		Encode:      encodeMetricRecord,
+		// Once the server is reachable again, leftover backup files are replayed.
+		OnDelivered: func() { ReplayBackups(url) },
+	})
+	metricsWorker.Start(ctx)
+	return metricsWorker
+}
+
+// EnqueueMetrics hands a snapshot to the metrics sender. It never waits
+// for the network, so collection keeps its schedule.
+func EnqueueMetrics(current collector.FullMetrics) {
+	payload := MetricPayload{
+		Timestamp: current.Timestamp,
+		Data:      current,
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		utils.ErrorLogger.Printf("Failed to encode metrics: %v", err)
+		return
+	}
+
+	sendMu.Lock()
+	worker := metricsWorker
+	sendMu.Unlock()
+
+	if worker == nil {
+		utils.WarnLogger.Printf("Metrics sender not started, dropping snapshot %d", payload.Timestamp)
+		return
+	}
+	worker.Enqueue(data)
+}
+
+// encodeMetricRecord turns a queued MetricPayload into a batch item, which
+// is the snapshot itself.
+func encodeMetricRecord(rec Record) ([]byte, error) {
+	var item MetricPayload
+	if err := json.Unmarshal(rec.Data, &item); err != nil {
+		return nil, err
+	}
+	return json.Marshal(item.Data)
+}
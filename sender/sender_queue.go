@@ -0,0 +1,85 @@
+package sender
+
+import (
+	"revnoa/utils"
+	"sync"
+	"time"
+)
+
+// Record is one queued payload waiting for a 2xx response.
+type Record struct {
+	Seq  uint64
+	Time time.Time
+	Data []byte
+}
+
+// Queue holds payloads until the server has accepted them. Records are
+// returned oldest first and only removed by Ack.
+type Queue interface {
+	Append(data []byte) error
+	Peek(n int) ([]Record, error)
+	Ack(seq uint64) error
+	Len() int
+	Close() error
+}
+
+// memoryQueue is used when file backup is disabled. It keeps at most
+// limit records and drops the oldest on overflow.
+type memoryQueue struct {
+	mu      sync.Mutex
+	records []Record
+	nextSeq uint64
+	limit   int
+}
+
+func newMemoryQueue(limit int) *memoryQueue {
+	return &memoryQueue{limit: limit, nextSeq: 1}
+}
+
+func (q *memoryQueue) Append(data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.records = append(q.records, Record{Seq: q.nextSeq, Time: time.Now(), Data: data})
+	q.nextSeq++
+
+	if q.limit > 0 && len(q.records) > q.limit {
+		dropped := len(q.records) - q.limit
+		utils.WarnLogger.Printf("Queue size exceeded (%d), dropping %d oldest", len(q.records), dropped)
+		q.records = append([]Record(nil), q.records[dropped:]...)
+	}
+	return nil
+}
+
+func (q *memoryQueue) Peek(n int) ([]Record, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if n > len(q.records) {
+		n = len(q.records)
+	}
+	return append([]Record(nil), q.records[:n]...), nil
+}
+
+func (q *memoryQueue) Ack(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, r := range q.records {
+		if r.Seq == seq {
+			q.records = append(q.records[:i], q.records[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (q *memoryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.records)
+}
+
+func (q *memoryQueue) Close() error {
+	return nil
+}
@@ -0,0 +1,475 @@
+package sender
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"revnoa/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FsyncAlways   = "always"
+	FsyncInterval = "interval"
+	FsyncNever    = "never"
+
+	defaultSegmentBytes = 8 << 20
+	defaultMaxBytes     = 256 << 20
+
+	segmentExt       = ".seg"
+	ackFileName      = "ack"
+	recordHeaderSize = 24
+	maxRecordSize    = 64 << 20
+)
+
+// DiskQueueOptions configures a DiskQueue. Zero values fall back to the
+// defaults: 8 MiB segments, 256 MiB in total, no age limit, fsync once
+// per second.
+type DiskQueueOptions struct {
+	Dir          string
+	SegmentBytes int64
+	MaxBytes     int64
+	MaxAge       time.Duration
+	Fsync        string
+}
+
+type segment struct {
+	first uint64
+	last  uint64
+	size  int64
+	path  string
+	file  *os.File
+}
+
+type recordRef struct {
+	seq  uint64
+	time time.Time
+	seg  *segment
+	off  int64
+	size int
+}
+
+// DiskQueue is a write-ahead queue made of append-only segment files.
+// Each record is written as seq, unix-nano time, length and CRC32 followed
+// by the payload. The ack file stores the lowest unacknowledged seq, so
+// anything after it is replayed when the queue is opened again.
+type DiskQueue struct {
+	mu       sync.Mutex
+	opts     DiskQueueOptions
+	segments []*segment
+	pending  []recordRef
+	acked    map[uint64]bool
+	head     uint64
+	nextSeq  uint64
+	lastSync time.Time
+}
+
+func OpenDiskQueue(opts DiskQueueOptions) (*DiskQueue, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("queue dir is empty")
+	}
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = defaultSegmentBytes
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultMaxBytes
+	}
+	if opts.Fsync == "" {
+		opts.Fsync = FsyncInterval
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	q := &DiskQueue{opts: opts, acked: make(map[uint64]bool), nextSeq: 1}
+	if err := q.load(); err != nil {
+		q.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *DiskQueue) load() error {
+	head, err := q.readAck()
+	if err != nil {
+		return err
+	}
+	q.head = head
+
+	entries, err := os.ReadDir(q.opts.Dir)
+	if err != nil {
+		return err
+	}
+
+	var firsts []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		firsts = append(firsts, first)
+	}
+	sort.Slice(firsts, func(i, j int) bool { return firsts[i] < firsts[j] })
+
+	for _, first := range firsts {
+		path := filepath.Join(q.opts.Dir, segmentName(first))
+		f, err := os.OpenFile(path, os.O_RDWR, 0644)
+		if err != nil {
+			return err
+		}
+		seg := &segment{first: first, path: path, file: f}
+		q.segments = append(q.segments, seg)
+		if err := q.scan(seg); err != nil {
+			return err
+		}
+	}
+
+	if q.nextSeq < q.head {
+		q.nextSeq = q.head
+	}
+	q.gc()
+
+	if len(q.pending) > 0 {
+		utils.InfoLogger.Printf("Queue %s has %d pending payloads to replay", q.opts.Dir, len(q.pending))
+	}
+	return nil
+}
+
+// scan indexes every intact record of seg. A torn or corrupt tail, which
+// is what a crash in the middle of a write leaves behind, is cut off.
+func (q *DiskQueue) scan(seg *segment) error {
+	header := make([]byte, recordHeaderSize)
+	var off int64
+
+	for {
+		n, err := seg.file.ReadAt(header, off)
+		if err == io.EOF && n == 0 {
+			break
+		}
+
+		valid := n == recordHeaderSize
+		var seq uint64
+		var ts int64
+		var size uint32
+		if valid {
+			seq = binary.LittleEndian.Uint64(header[0:8])
+			ts = int64(binary.LittleEndian.Uint64(header[8:16]))
+			size = binary.LittleEndian.Uint32(header[16:20])
+			valid = size <= maxRecordSize
+		}
+		if valid {
+			data := make([]byte, size)
+			if _, err := seg.file.ReadAt(data, off+recordHeaderSize); err != nil {
+				valid = false
+			} else {
+				valid = crc32.ChecksumIEEE(data) == binary.LittleEndian.Uint32(header[20:24])
+			}
+		}
+		if !valid {
+			utils.WarnLogger.Printf("Queue segment %s is corrupt at offset %d, truncating", seg.path, off)
+			if err := seg.file.Truncate(off); err != nil {
+				return err
+			}
+			break
+		}
+
+		if seq >= q.head {
+			q.pending = append(q.pending, recordRef{
+				seq:  seq,
+				time: time.Unix(0, ts),
+				seg:  seg,
+				off:  off + recordHeaderSize,
+				size: int(size),
+			})
+		}
+		seg.last = seq
+		if seq >= q.nextSeq {
+			q.nextSeq = seq + 1
+		}
+		off += recordHeaderSize + int64(size)
+	}
+
+	seg.size = off
+	return nil
+}
+
+func (q *DiskQueue) Append(data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(data) > maxRecordSize {
+		return fmt.Errorf("payload too large: %d bytes", len(data))
+	}
+	q.expire()
+
+	seg, err := q.activeSegment()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	buf := make([]byte, recordHeaderSize+len(data))
+	binary.LittleEndian.PutUint64(buf[0:8], q.nextSeq)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(now.UnixNano()))
+	binary.LittleEndian.PutUint32(buf[16:20], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[20:24], crc32.ChecksumIEEE(data))
+	copy(buf[recordHeaderSize:], data)
+
+	if _, err := seg.file.WriteAt(buf, seg.size); err != nil {
+		return err
+	}
+	q.sync(seg.file)
+
+	q.pending = append(q.pending, recordRef{
+		seq:  q.nextSeq,
+		time: now,
+		seg:  seg,
+		off:  seg.size + recordHeaderSize,
+		size: len(data),
+	})
+	seg.last = q.nextSeq
+	seg.size += int64(len(buf))
+	q.nextSeq++
+
+	q.enforceMaxBytes()
+	return nil
+}
+
+func (q *DiskQueue) Peek(n int) ([]Record, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.expire()
+
+	var records []Record
+	for _, ref := range q.pending {
+		if len(records) >= n {
+			break
+		}
+		if q.acked[ref.seq] {
+			continue
+		}
+		data := make([]byte, ref.size)
+		if _, err := ref.seg.file.ReadAt(data, ref.off); err != nil {
+			return records, err
+		}
+		records = append(records, Record{Seq: ref.seq, Time: ref.time, Data: data})
+	}
+	return records, nil
+}
+
+// Ack marks one record as delivered. Records can be acknowledged out of
+// order; the persisted head only moves past a contiguous run.
+func (q *DiskQueue) Ack(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if seq < q.head || seq >= q.nextSeq {
+		return nil
+	}
+	q.acked[seq] = true
+	return q.advance()
+}
+
+func (q *DiskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending) - len(q.acked)
+}
+
+func (q *DiskQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var firstErr error
+	for _, seg := range q.segments {
+		if q.opts.Fsync != FsyncNever {
+			seg.file.Sync()
+		}
+		if err := seg.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	q.segments = nil
+	return firstErr
+}
+
+func (q *DiskQueue) advance() error {
+	for len(q.pending) > 0 && q.acked[q.pending[0].seq] {
+		delete(q.acked, q.pending[0].seq)
+		q.pending = q.pending[1:]
+	}
+
+	head := q.nextSeq
+	if len(q.pending) > 0 {
+		head = q.pending[0].seq
+	}
+	if head == q.head {
+		return nil
+	}
+	q.head = head
+
+	err := q.writeAck()
+	q.gc()
+	return err
+}
+
+// expire drops records older than MaxAge.
+func (q *DiskQueue) expire() {
+	if q.opts.MaxAge <= 0 {
+		return
+	}
+
+	cutoff := time.Now().Add(-q.opts.MaxAge)
+	dropped := 0
+	for _, ref := range q.pending {
+		if !ref.time.Before(cutoff) {
+			break
+		}
+		if !q.acked[ref.seq] {
+			q.acked[ref.seq] = true
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		utils.WarnLogger.Printf("Dropped %d queued payloads older than %v", dropped, q.opts.MaxAge)
+		if err := q.advance(); err != nil {
+			utils.ErrorLogger.Printf("Failed to update queue ack: %v", err)
+		}
+	}
+}
+
+// enforceMaxBytes drops whole segments, oldest first, until the queue fits
+// in MaxBytes again. The active segment is never dropped.
+func (q *DiskQueue) enforceMaxBytes() {
+	var total int64
+	for _, seg := range q.segments {
+		total += seg.size
+	}
+
+	dropped := 0
+	for total > q.opts.MaxBytes && len(q.segments) > 1 {
+		oldest := q.segments[0]
+		for _, ref := range q.pending {
+			if ref.seg != oldest {
+				break
+			}
+			if !q.acked[ref.seq] {
+				q.acked[ref.seq] = true
+				dropped++
+			}
+		}
+		total -= oldest.size
+
+		if err := q.advance(); err != nil {
+			utils.ErrorLogger.Printf("Failed to update queue ack: %v", err)
+		}
+		if len(q.segments) > 0 && q.segments[0] == oldest {
+			// Nothing in it was pending; gc keeps only fully acked segments.
+			q.removeSegment(0)
+		}
+	}
+	if dropped > 0 {
+		utils.WarnLogger.Printf("Queue exceeded %d bytes, dropped %d oldest payloads", q.opts.MaxBytes, dropped)
+	}
+}
+
+// gc removes every segment except the active one whose records are all acked.
+func (q *DiskQueue) gc() {
+	for len(q.segments) > 1 && q.segments[0].last < q.head {
+		q.removeSegment(0)
+	}
+	if len(q.segments) == 1 && q.segments[0].size == 0 && q.segments[0].first < q.head {
+		q.removeSegment(0)
+	}
+}
+
+func (q *DiskQueue) removeSegment(i int) {
+	seg := q.segments[i]
+	seg.file.Close()
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		utils.WarnLogger.Printf("Failed to remove queue segment %s: %v", seg.path, err)
+	}
+	q.segments = append(q.segments[:i], q.segments[i+1:]...)
+}
+
+func (q *DiskQueue) activeSegment() (*segment, error) {
+	if n := len(q.segments); n > 0 && q.segments[n-1].size < q.opts.SegmentBytes {
+		return q.segments[n-1], nil
+	}
+
+	path := filepath.Join(q.opts.Dir, segmentName(q.nextSeq))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	seg := &segment{first: q.nextSeq, path: path, file: f}
+	q.segments = append(q.segments, seg)
+	q.gc()
+	return seg, nil
+}
+
+func (q *DiskQueue) sync(f *os.File) {
+	switch q.opts.Fsync {
+	case FsyncAlways:
+		f.Sync()
+	case FsyncInterval:
+		if time.Since(q.lastSync) >= time.Second {
+			f.Sync()
+			q.lastSync = time.Now()
+		}
+	}
+}
+
+func (q *DiskQueue) readAck() (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(q.opts.Dir, ackFileName))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	head, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		utils.WarnLogger.Printf("Ignoring unreadable queue ack file: %v", err)
+		return 0, nil
+	}
+	return head, nil
+}
+
+func (q *DiskQueue) writeAck() error {
+	path := filepath.Join(q.opts.Dir, ackFileName)
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(strconv.FormatUint(q.head, 10)); err != nil {
+		f.Close()
+		return err
+	}
+	if q.opts.Fsync == FsyncAlways {
+		f.Sync()
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func segmentName(first uint64) string {
+	return fmt.Sprintf("%020d%s", first, segmentExt)
+}
@@ -0,0 +1,136 @@
+package sender
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestQueue(t *testing.T, opts DiskQueueOptions) *DiskQueue {
+	t.Helper()
+	utils.InitLogger(true)
+
+	q, err := OpenDiskQueue(opts)
+	require.NoError(t, err)
+	return q
+}
+
+func TestDiskQueueReplaysAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	q := openTestQueue(t, DiskQueueOptions{Dir: dir, Fsync: FsyncAlways})
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, q.Append([]byte(fmt.Sprintf("payload-%d", i))))
+	}
+
+	records, err := q.Peek(10)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.NoError(t, q.Ack(records[0].Seq))
+	require.NoError(t, q.Close())
+
+	q = openTestQueue(t, DiskQueueOptions{Dir: dir})
+	defer q.Close()
+
+	assert.Equal(t, 2, q.Len())
+	records, err = q.Peek(10)
+	require.NoError(t, err)
+	assert.Equal(t, "payload-2", string(records[0].Data))
+	assert.Equal(t, "payload-3", string(records[1].Data))
+
+	require.NoError(t, q.Append([]byte("payload-4")))
+	records, _ = q.Peek(10)
+	assert.Equal(t, records[1].Seq+1, records[2].Seq)
+}
+
+func TestDiskQueueOutOfOrderAck(t *testing.T) {
+	dir := t.TempDir()
+
+	q := openTestQueue(t, DiskQueueOptions{Dir: dir})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, q.Append([]byte("x")))
+	}
+	records, _ := q.Peek(10)
+	require.NoError(t, q.Ack(records[1].Seq))
+
+	assert.Equal(t, 2, q.Len())
+	peeked, _ := q.Peek(10)
+	assert.Equal(t, []uint64{records[0].Seq, records[2].Seq}, []uint64{peeked[0].Seq, peeked[1].Seq})
+	require.NoError(t, q.Close())
+
+	// Only the contiguous head is persisted, so the out-of-order ack is redelivered.
+	q = openTestQueue(t, DiskQueueOptions{Dir: dir})
+	defer q.Close()
+	assert.Equal(t, 3, q.Len())
+}
+
+func TestDiskQueueTruncatesTornWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	q := openTestQueue(t, DiskQueueOptions{Dir: dir})
+	require.NoError(t, q.Append([]byte("complete")))
+	require.NoError(t, q.Close())
+
+	seg := filepath.Join(dir, segmentName(1))
+	f, err := os.OpenFile(seg, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0x02, 0x00, 0x00})
+	require.NoError(t, err)
+	f.Close()
+
+	q = openTestQueue(t, DiskQueueOptions{Dir: dir})
+	defer q.Close()
+
+	records, err := q.Peek(10)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "complete", string(records[0].Data))
+
+	require.NoError(t, q.Append([]byte("next")))
+	records, _ = q.Peek(10)
+	assert.Equal(t, "next", string(records[1].Data))
+}
+
+func TestDiskQueueLimits(t *testing.T) {
+	dir := t.TempDir()
+
+	q := openTestQueue(t, DiskQueueOptions{Dir: dir, SegmentBytes: 64, MaxBytes: 200})
+	defer q.Close()
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, q.Append([]byte(fmt.Sprintf("payload-%02d-padding", i))))
+	}
+
+	var total int64
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) == segmentExt {
+			info, _ := e.Info()
+			total += info.Size()
+		}
+	}
+	assert.LessOrEqual(t, total, int64(200))
+
+	records, _ := q.Peek(100)
+	require.NotEmpty(t, records)
+	assert.Equal(t, "payload-19-padding", string(records[len(records)-1].Data))
+	assert.Less(t, len(records), 20)
+
+	q.opts.MaxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, 0, len(mustPeek(t, q)))
+	assert.Equal(t, 0, q.Len())
+}
+
+func mustPeek(t *testing.T, q Queue) []Record {
+	records, err := q.Peek(100)
+	require.NoError(t, err)
+	return records
+}
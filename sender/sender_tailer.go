@@ -1,28 +1,195 @@
-package sender
-
-import (
-	"revnoa/utils"
-)
-
-type LogPayload struct {
-	AgentID string   `json:"agent_id"`
-	Lines   []string `json:"lines"`
-}
-
-func SendLogs(endpoint string, lines []string, agentID string) {
-	if endpoint == "" {
-		utils.WarnLogger.Println("Tailer Endpoint is empty")
-		return
-	}
-
-	payload := LogPayload{
-		AgentID: agentID,
-		Lines:   lines,
-	}
-
-	utils.InfoLogger.Printf("Sending %d lines to %s", len(lines), endpoint)
-
-	if err := SendPOST(endpoint, payload, ApiKey, "log"); err != nil {
-		utils.ErrorLogger.Printf("Failed to send tailer: %v", err)
-	}
-}
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"revnoa/collector"
+	"revnoa/utils"
+	"sync"
+	"time"
+)
+
+// defaultLogsMaxPending bounds the log queue when no limit is configured.
+const defaultLogsMaxPending = 1000
+
+// Log payload versions. Version 1 is the original {agent_id, lines};
+// version 2 adds version and records.
+const (
+	LogPayloadV1 = 1
+	LogPayloadV2 = 2
+)
+
+// logBatchOptions sends every log batch in a request of its own, as the
+// plain LogPayload object and uncompressed, whatever the metric batch
+// settings, so servers keep getting the payload version they expect.
+var logBatchOptions = defaultBatchOptions
+
+var (
+	logsQueue      Queue = newMemoryQueue(0)
+	logsWorker     *Worker
+	logsMu         sync.Mutex
+	payloadVersion = LogPayloadV2
+)
+
+// LogPayload is a batch of log lines. Lines is kept in every version so
+// servers that only know version 1 keep working; Records holds the
+// metadata of Lines[i] at the same index.
+type LogPayload struct {
+	Version int         `json:"version,omitempty"`
+	AgentID string      `json:"agent_id"`
+	Lines   []string    `json:"lines"`
+	Records []LogRecord `json:"records,omitempty"`
+}
+
+// LogRecord describes one line: where it was read from and when, the
+// static labels of its source, and the fields and event time a parser
+// extracted.
+type LogRecord struct {
+	Path      string            `json:"path"`
+	Offset    int64             `json:"offset"`
+	ReadAt    time.Time         `json:"read_at"`
+	Host      string            `json:"host"`
+	Source    string            `json:"source,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Fields    map[string]any    `json:"fields,omitempty"`
+	Timestamp *time.Time        `json:"timestamp,omitempty"`
+	Repeat    int               `json:"repeat,omitempty"`
+}
+
+// queuedLogs is what the log queue stores: the payload to send and the
+// file positions to commit once the server has accepted it.
+type queuedLogs struct {
+	Payload   LogPayload               `json:"payload"`
+	Positions []collector.FilePosition `json:"positions,omitempty"`
+}
+
+// SetLogPayloadVersion selects the log payload format. Version 1 drops
+// the records for servers that reject unknown fields; zero keeps the
+// default of 2.
+func SetLogPayloadVersion(v int) {
+	logsMu.Lock()
+	defer logsMu.Unlock()
+	if v == 0 {
+		v = LogPayloadV2
+	}
+	payloadVersion = v
+}
+
+// SetLogsQueue replaces the in-memory log queue, typically with a DiskQueue.
+func SetLogsQueue(q Queue) {
+	logsMu.Lock()
+	defer logsMu.Unlock()
+	logsQueue = q
+}
+
+// StartLogsSender starts the worker that delivers queued log batches to
+// url. At most maxPending batches are queued; beyond that SendLogs blocks
+// so the tailer stops reading instead of lines being dropped. commit is
+// called with the file positions of every delivered batch, in queue
+// order, so no position passes a batch that is still undelivered.
+func StartLogsSender(ctx context.Context, url string, concurrency, bufferSize, maxPending int, commit func([]collector.FilePosition)) *Worker {
+	logsMu.Lock()
+	defer logsMu.Unlock()
+
+	if maxPending <= 0 {
+		maxPending = defaultLogsMaxPending
+	}
+	logsWorker = NewWorker(WorkerOptions{
+		Name:        "log",
+		URL:         url,
+		Queue:       logsQueue,
+		Concurrency: concurrency,
+		BufferSize:  bufferSize,
+		MaxPending:  maxPending,
+		Batch:       logBatchOptions,
+		Encode:      encodeLogRecord,
+		OnAck: func(rec Record) {
+			if commit == nil {
+				return
+			}
+			var item queuedLogs
+			if err := json.Unmarshal(rec.Data, &item); err == nil {
+				commit(item.Positions)
+			}
+		},
+	})
+	logsWorker.Start(ctx)
+	return logsWorker
+}
+
+// SendLogs queues events for delivery. It blocks while the log queue is
+// full and returns once the batch is handed to the sender.
+func SendLogs(events []collector.LogEvent, positions []collector.FilePosition, agentID string) {
+	logsMu.Lock()
+	worker, version := logsWorker, payloadVersion
+	logsMu.Unlock()
+
+	if worker == nil {
+		utils.WarnLogger.Printf("Log sender not started, dropping %d lines", len(events))
+		return
+	}
+
+	data, err := json.Marshal(queuedLogs{
+		Payload:   newLogPayload(version, agentID, events),
+		Positions: positions,
+	})
+	if err != nil {
+		utils.ErrorLogger.Printf("Failed to encode log batch: %v", err)
+		return
+	}
+
+	if err := worker.EnqueueWait(context.Background(), data); err != nil {
+		utils.ErrorLogger.Printf("Failed to queue %d log lines: %v", len(events), err)
+	}
+}
+
+func newLogPayload(version int, agentID string, events []collector.LogEvent) LogPayload {
+	payload := LogPayload{AgentID: agentID, Lines: make([]string, 0, len(events))}
+	for _, ev := range events {
+		payload.Lines = append(payload.Lines, ev.Text)
+	}
+	if version == LogPayloadV1 {
+		return payload
+	}
+
+	host := hostname()
+	payload.Version = LogPayloadV2
+	payload.Records = make([]LogRecord, 0, len(events))
+	for _, ev := range events {
+		rec := LogRecord{
+			Path:   ev.Path,
+			Offset: ev.Offset,
+			ReadAt: ev.ReadAt,
+			Host:   host,
+			Source: ev.Source,
+			Labels: ev.Labels,
+			Fields: ev.Fields,
+		}
+		if !ev.Time.IsZero() {
+			ts := ev.Time
+			rec.Timestamp = &ts
+		}
+		if ev.Repeat > 1 {
+			rec.Repeat = ev.Repeat
+		}
+		payload.Records = append(payload.Records, rec)
+	}
+	return payload
+}
+
+var hostname = sync.OnceValue(func() string {
+	name, err := os.Hostname()
+	if err != nil {
+		utils.WarnLogger.Printf("Failed to get hostname for log records: %v", err)
+	}
+	return name
+})
+
+func encodeLogRecord(rec Record) ([]byte, error) {
+	var item queuedLogs
+	if err := json.Unmarshal(rec.Data, &item); err != nil {
+		return nil, err
+	}
+	return json.Marshal(item.Payload)
+}
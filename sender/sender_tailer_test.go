@@ -0,0 +1,88 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"revnoa/collector"
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogPayloadRecords(t *testing.T) {
+	readAt := time.Date(2025, 1, 1, 0, 0, 1, 0, time.UTC)
+	ts := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []collector.LogEvent{
+		{
+			Text: `{"level":"info"}`, Fields: map[string]any{"level": "info"}, Time: ts,
+			Source: "api", Path: "/var/log/api.log", Offset: 0, ReadAt: readAt,
+			Labels: map[string]string{"env": "prod"},
+		},
+		{Text: "plain", Repeat: 3, Source: "api", Path: "/var/log/api.log", Offset: 17, ReadAt: readAt},
+	}
+
+	data, err := json.Marshal(newLogPayload(LogPayloadV1, "agent", events))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"agent_id":"agent","lines":["{\"level\":\"info\"}","plain"]}`, string(data))
+
+	data, err = json.Marshal(newLogPayload(LogPayloadV2, "agent", events))
+	require.NoError(t, err)
+	host := hostname()
+	assert.JSONEq(t, `{
+		"version": 2,
+		"agent_id": "agent",
+		"lines": ["{\"level\":\"info\"}", "plain"],
+		"records": [
+			{
+				"path": "/var/log/api.log", "offset": 0, "read_at": "2025-01-01T00:00:01Z", "host": "`+host+`",
+				"source": "api", "labels": {"env": "prod"},
+				"fields": {"level": "info"}, "timestamp": "2025-01-01T00:00:00Z"
+			},
+			{
+				"path": "/var/log/api.log", "offset": 17, "read_at": "2025-01-01T00:00:01Z", "host": "`+host+`",
+				"source": "api", "repeat": 3
+			}
+		]
+	}`, string(data))
+}
+
+func TestSendLogsIgnoresMetricBatching(t *testing.T) {
+	utils.InitLogger(true)
+	SetBatchConfig(BatchOptions{MaxItems: 10, Format: BatchNDJSON, Compression: CompressionGzip})
+	defer SetBatchConfig(BatchOptions{})
+
+	type request struct{ body, encoding string }
+	requests := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{string(body), r.Header.Get("Content-Encoding")}
+	}))
+	defer srv.Close()
+
+	SetLogsQueue(newMemoryQueue(0))
+	ctx, cancel := context.WithCancel(context.Background())
+	worker := StartLogsSender(ctx, srv.URL, 1, 10, 0, nil)
+	defer func() {
+		cancel()
+		worker.Wait()
+	}()
+
+	SetLogPayloadVersion(LogPayloadV1)
+	defer SetLogPayloadVersion(0)
+	SendLogs([]collector.LogEvent{{Text: "boom"}}, nil, "agent")
+
+	select {
+	case req := <-requests:
+		assert.Empty(t, req.encoding)
+		assert.JSONEq(t, `{"agent_id":"agent","lines":["boom"]}`, req.body)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "log batch not sent")
+	}
+}
@@ -0,0 +1,373 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"revnoa/utils"
+	"sync"
+	"time"
+)
+
+// WorkerOptions configures a Worker. Encode turns a queued record into one
+// JSON item of a batch; an error drops the record as unreadable. OnAck is
+// called for every record the server has accepted or rejected for good,
+// in queue order: a record acked ahead of an earlier one is held back
+// until the earlier one is done. With MaxPending set
+// the worker stops taking new payloads while that many records are
+// queued, so EnqueueWait blocks instead of the queue dropping.
+type WorkerOptions struct {
+	Name        string
+	URL         string
+	Queue       Queue
+	Concurrency int
+	BufferSize  int
+	MaxPending  int
+	Batch       BatchOptions
+	Encode      func(rec Record) ([]byte, error)
+	OnDelivered func()
+	OnAck       func(rec Record)
+}
+
+// Worker is the long-lived sender for one endpoint. Producers hand payloads
+// to a bounded channel and return immediately; the worker persists them in
+// its Queue and keeps up to Concurrency batches in flight. A record is
+// acked only after a 2xx response, so acks may complete out of order.
+type Worker struct {
+	opts    WorkerOptions
+	breaker *Breaker
+
+	in      chan []byte
+	results chan sendResult
+	done    chan struct{}
+
+	drain     chan struct{}
+	drainOnce sync.Once
+
+	inflight map[uint64]bool
+	active   int
+	retryAt  time.Time
+	wg       sync.WaitGroup
+
+	// acked holds records done ahead of the next one OnAck is due for.
+	// If the queue drops a record before it is delivered, OnAck stops
+	// for the rest of the run, so the log positions stay before lines
+	// that must be read again.
+	acked   map[uint64]Record
+	nextAck uint64
+	stalled bool
+
+	// maxItems is the current batch size limit. It is halved when the
+	// server answers 413 and grows back to Batch.MaxItems on success.
+	maxItems int
+}
+
+type sendResult struct {
+	records []Record
+	err     error
+}
+
+func NewWorker(opts WorkerOptions) *Worker {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 100
+	}
+	opts.Batch = opts.Batch.withDefaults()
+	return &Worker{
+		opts:     opts,
+		breaker:  breakerFor(opts.URL),
+		in:       make(chan []byte, opts.BufferSize),
+		results:  make(chan sendResult, opts.Concurrency),
+		done:     make(chan struct{}),
+		drain:    make(chan struct{}),
+		inflight: map[uint64]bool{},
+		acked:    map[uint64]Record{},
+		maxItems: opts.Batch.MaxItems,
+	}
+}
+
+// Enqueue hands data to the worker without blocking. It returns false if
+// the buffer is full and the payload was dropped.
+func (w *Worker) Enqueue(data []byte) bool {
+	select {
+	case w.in <- data:
+		return true
+	default:
+		utils.WarnLogger.Printf("[%s] send buffer full, dropping payload", w.opts.Name)
+		return false
+	}
+}
+
+// EnqueueWait hands data to the worker, blocking while the buffer is full.
+func (w *Worker) EnqueueWait(ctx context.Context, data []byte) error {
+	select {
+	case w.in <- data:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.done:
+		return errors.New("worker stopped")
+	}
+}
+
+// Drain lifts the MaxPending limit, so producers flushing their last
+// payloads on shutdown are not held up by an unreachable server.
+func (w *Worker) Drain() {
+	w.drainOnce.Do(func() { close(w.drain) })
+}
+
+// Start runs the worker until ctx is cancelled. Payloads still buffered at
+// that point are written to the queue, and in-flight requests are awaited.
+func (w *Worker) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer close(w.done)
+		w.run(ctx)
+	}()
+}
+
+// Wait blocks until the worker started by Start has returned.
+func (w *Worker) Wait() {
+	w.wg.Wait()
+}
+
+func (w *Worker) run(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	drain, draining := w.drain, false
+	for {
+		w.dispatch()
+		w.resetTimer(timer)
+
+		in := w.in
+		if !draining && w.opts.MaxPending > 0 && w.opts.Queue.Len() >= w.opts.MaxPending {
+			in = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			w.shutdown()
+			return
+		case <-drain:
+			drain, draining = nil, true
+		case data := <-in:
+			w.append(data)
+		case res := <-w.results:
+			w.handle(res)
+		case <-timer.C:
+		}
+	}
+}
+
+// dispatch batches the oldest records not already in flight and starts
+// sending them. While the endpoint is backing off nothing is sent; while
+// its breaker is not closed only a single request is in flight.
+func (w *Worker) dispatch() {
+	if time.Now().Before(w.retryAt) {
+		return
+	}
+
+	limit := w.opts.Concurrency
+	if w.breaker.State() != StateClosed {
+		limit = 1
+	}
+	free := limit - w.active
+	if free <= 0 {
+		return
+	}
+
+	records, err := w.opts.Queue.Peek(len(w.inflight) + free*w.maxItems)
+	if err != nil {
+		utils.ErrorLogger.Printf("[%s] failed to read queue: %v", w.opts.Name, err)
+		return
+	}
+	if len(records) > 0 {
+		w.checkEvicted(records[0].Seq)
+	}
+
+	var batch []Record
+	var items [][]byte
+	size := 0
+	for _, rec := range records {
+		if w.inflight[rec.Seq] {
+			continue
+		}
+
+		item, err := w.opts.Encode(rec)
+		if err != nil {
+			utils.ErrorLogger.Printf("[%s] dropping unreadable queued payload %d: %v", w.opts.Name, rec.Seq, err)
+			w.opts.Queue.Ack(rec.Seq)
+			w.settle(rec)
+			continue
+		}
+
+		if len(items) > 0 && size+len(item)+1 > w.opts.Batch.MaxBytes {
+			w.send(batch, items)
+			batch, items, size = nil, nil, 0
+			if free--; free == 0 {
+				return
+			}
+		}
+		batch = append(batch, rec)
+		items = append(items, item)
+		size += len(item) + 1
+
+		if len(items) == w.maxItems {
+			w.send(batch, items)
+			batch, items, size = nil, nil, 0
+			if free--; free == 0 {
+				return
+			}
+		}
+	}
+	if len(items) > 0 {
+		w.send(batch, items)
+	}
+}
+
+func (w *Worker) send(batch []Record, items [][]byte) {
+	body, err := encodeBatch(items, w.opts.Batch)
+	if err != nil {
+		utils.ErrorLogger.Printf("[%s] failed to encode batch: %v", w.opts.Name, err)
+		return
+	}
+
+	for _, rec := range batch {
+		w.inflight[rec.Seq] = true
+	}
+	w.active++
+	go func() {
+		w.results <- sendResult{records: batch, err: postBody(w.opts.URL, body, ApiKey, w.opts.Name)}
+	}()
+}
+
+// finish acks the records of a delivered batch. Records of a failed
+// batch stay queued, whatever the response, and are sent again later.
+func (w *Worker) finish(res sendResult) {
+	w.active--
+	for _, rec := range res.records {
+		delete(w.inflight, rec.Seq)
+		if res.err != nil {
+			continue
+		}
+		if err := w.opts.Queue.Ack(rec.Seq); err != nil {
+			utils.ErrorLogger.Printf("[%s] failed to ack payload %d: %v", w.opts.Name, rec.Seq, err)
+		}
+		w.settle(rec)
+	}
+}
+
+// settle calls OnAck for rec and the records held back behind it, once
+// every earlier record is done too.
+func (w *Worker) settle(rec Record) {
+	if w.opts.OnAck == nil || w.stalled {
+		return
+	}
+	if w.nextAck == 0 {
+		// Records are sent oldest first, so the first one done is the
+		// oldest of this run, or one sent along with it.
+		w.nextAck = rec.Seq
+		if head, err := w.opts.Queue.Peek(1); err == nil && len(head) > 0 && head[0].Seq < rec.Seq {
+			w.nextAck = head[0].Seq
+		}
+	}
+	w.acked[rec.Seq] = rec
+	for {
+		next, ok := w.acked[w.nextAck]
+		if !ok {
+			return
+		}
+		delete(w.acked, w.nextAck)
+		w.nextAck++
+		w.opts.OnAck(next)
+	}
+}
+
+// checkEvicted stops OnAck once a record before head, the oldest queued
+// one, is neither done nor queued: the queue dropped it undelivered.
+func (w *Worker) checkEvicted(head uint64) {
+	if w.opts.OnAck == nil || w.stalled || w.nextAck == 0 || w.nextAck >= head {
+		return
+	}
+	if _, ok := w.acked[w.nextAck]; ok {
+		return
+	}
+	utils.WarnLogger.Printf("[%s] payload %d was dropped undelivered, not acking later payloads until restart", w.opts.Name, w.nextAck)
+	w.stalled = true
+	w.acked = nil
+}
+
+func (w *Worker) handle(res sendResult) {
+	w.finish(res)
+
+	if res.err != nil {
+		// A batch too large for the server is retried in smaller ones.
+		var status *StatusError
+		if errors.As(res.err, &status) && status.StatusCode == http.StatusRequestEntityTooLarge && len(res.records) > 1 {
+			w.maxItems = max(len(res.records)/2, 1)
+			utils.WarnLogger.Printf("[%s] batch of %d payloads too large, sending at most %d at once", w.opts.Name, len(res.records), w.maxItems)
+		}
+
+		wait := w.breaker.RetryIn()
+		if wait <= 0 {
+			wait = time.Second
+		}
+		w.retryAt = time.Now().Add(wait)
+
+		if errors.Is(res.err, ErrCircuitOpen) {
+			utils.WarnLogger.Printf("[%s] endpoint backing off, %d payloads queued", w.opts.Name, w.opts.Queue.Len())
+		} else {
+			utils.ErrorLogger.Printf("[%s] send failed (%d pending): %v", w.opts.Name, w.opts.Queue.Len(), res.err)
+		}
+		return
+	}
+
+	w.retryAt = time.Time{}
+	w.maxItems = min(w.maxItems*2, w.opts.Batch.MaxItems)
+	if w.opts.OnDelivered != nil {
+		w.opts.OnDelivered()
+	}
+}
+
+func (w *Worker) append(data []byte) {
+	if err := w.opts.Queue.Append(data); err != nil {
+		utils.ErrorLogger.Printf("[%s] failed to queue payload: %v", w.opts.Name, err)
+	}
+}
+
+// resetTimer arms timer for the end of the current backoff, or parks it
+// when there is nothing to wait for.
+func (w *Worker) resetTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+
+	wait := time.Hour
+	if d := time.Until(w.retryAt); d > 0 {
+		wait = d
+	}
+	timer.Reset(wait)
+}
+
+func (w *Worker) shutdown() {
+	for {
+		select {
+		case data := <-w.in:
+			w.append(data)
+			continue
+		default:
+		}
+		break
+	}
+
+	for w.active > 0 {
+		w.finish(<-w.results)
+	}
+}
@@ -0,0 +1,273 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"revnoa/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rawRecord(rec Record) ([]byte, error) {
+	return rec.Data, nil
+}
+
+func TestWorkerDeliversConcurrently(t *testing.T) {
+	utils.InitLogger(true)
+
+	var active, peak, delivered int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&active, -1)
+		atomic.AddInt32(&delivered, 1)
+	}))
+	defer srv.Close()
+
+	queue := newMemoryQueue(0)
+	worker := NewWorker(WorkerOptions{Name: "test", URL: srv.URL, Queue: queue, Concurrency: 3, Encode: rawRecord})
+	ctx, cancel := context.WithCancel(context.Background())
+	worker.Start(ctx)
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		require.True(t, worker.Enqueue([]byte(fmt.Sprintf(`{"n":%d}`, i))))
+	}
+	assert.Less(t, time.Since(start), 100*time.Millisecond, "enqueue must not wait for the server")
+
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&active) == 3 }, time.Second, 5*time.Millisecond)
+	close(release)
+	require.Eventually(t, func() bool { return queue.Len() == 0 }, 2*time.Second, 5*time.Millisecond)
+
+	cancel()
+	worker.Wait()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&peak))
+	assert.Equal(t, int32(6), atomic.LoadInt32(&delivered))
+}
+
+func TestWorkerKeepsPayloadsOnFailure(t *testing.T) {
+	utils.InitLogger(true)
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	queue := newMemoryQueue(0)
+	worker := NewWorker(WorkerOptions{Name: "test", URL: srv.URL, Queue: queue, Encode: rawRecord})
+	ctx, cancel := context.WithCancel(context.Background())
+	worker.Start(ctx)
+
+	worker.Enqueue([]byte(`{"n":1}`))
+	worker.Enqueue([]byte(`{"n":2}`))
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) >= 1 }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	worker.Wait()
+	assert.Equal(t, 2, queue.Len())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "backing off after the first failure")
+}
+
+func TestWorkerBackpressure(t *testing.T) {
+	utils.InitLogger(true)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	queue := newMemoryQueue(0)
+	worker := NewWorker(WorkerOptions{Name: "test", URL: srv.URL, Queue: queue, BufferSize: 1, MaxPending: 2, Encode: rawRecord})
+	ctx, cancel := context.WithCancel(context.Background())
+	worker.Start(ctx)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, worker.EnqueueWait(ctx, []byte(`{}`)))
+	}
+	require.Eventually(t, func() bool { return queue.Len() == 2 }, time.Second, 5*time.Millisecond)
+
+	// Two queued and one buffered: the next producer has to wait.
+	waitCtx, waitCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer waitCancel()
+	assert.ErrorIs(t, worker.EnqueueWait(waitCtx, []byte(`{}`)), context.DeadlineExceeded)
+
+	// Draining for shutdown lets the last payloads in past the limit.
+	worker.Drain()
+	require.NoError(t, worker.EnqueueWait(ctx, []byte(`{}`)))
+	require.Eventually(t, func() bool { return queue.Len() == 4 }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	worker.Wait()
+	assert.Equal(t, 4, queue.Len(), "drained payloads are kept on shutdown")
+}
+
+func TestWorkerKeepsRejectedPayloads(t *testing.T) {
+	utils.InitLogger(true)
+
+	var calls, accept int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&accept) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	queue := newMemoryQueue(0)
+	var mu sync.Mutex
+	var acked []string
+	worker := NewWorker(WorkerOptions{
+		Name: "test", URL: srv.URL, Queue: queue, Encode: rawRecord,
+		OnAck: func(rec Record) {
+			mu.Lock()
+			acked = append(acked, string(rec.Data))
+			mu.Unlock()
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		worker.Wait()
+	}()
+	worker.Start(ctx)
+
+	worker.Enqueue([]byte(`{"n":1}`))
+	worker.Enqueue([]byte(`{"n":2}`))
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) > 0 }, 2*time.Second, 5*time.Millisecond)
+	assert.Positive(t, breakerFor(srv.URL).RetryIn(), "a 4xx backs off like any failure")
+
+	atomic.StoreInt32(&accept, 1)
+	require.Eventually(t, func() bool { return queue.Len() == 0 }, 5*time.Second, 5*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{`{"n":1}`, `{"n":2}`}, acked, "rejected payloads are sent again, not dropped")
+}
+
+func TestWorkerSplitsTooLargeBatches(t *testing.T) {
+	utils.InitLogger(true)
+
+	var mu sync.Mutex
+	var sizes []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items []json.RawMessage
+		json.NewDecoder(r.Body).Decode(&items)
+		mu.Lock()
+		sizes = append(sizes, len(items))
+		mu.Unlock()
+		if len(items) > 2 {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}))
+	defer srv.Close()
+
+	queue := newMemoryQueue(0)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, queue.Append([]byte(fmt.Sprintf(`{"n":%d}`, i))))
+	}
+	worker := NewWorker(WorkerOptions{
+		Name: "test", URL: srv.URL, Queue: queue, Encode: rawRecord,
+		Batch: BatchOptions{MaxItems: 4, Format: BatchJSON},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	worker.Start(ctx)
+
+	require.Eventually(t, func() bool { return queue.Len() == 0 }, 5*time.Second, 5*time.Millisecond)
+	cancel()
+	worker.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int{4, 2, 2}, sizes)
+}
+
+func TestWorkerAcksInQueueOrder(t *testing.T) {
+	utils.InitLogger(true)
+
+	release := make(chan struct{})
+	var delivered int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == `{"n":0}` {
+			<-release
+		}
+		atomic.AddInt32(&delivered, 1)
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var acked []string
+	queue := newMemoryQueue(0)
+	worker := NewWorker(WorkerOptions{
+		Name: "test", URL: srv.URL, Queue: queue, Concurrency: 2, Encode: rawRecord,
+		OnAck: func(rec Record) {
+			mu.Lock()
+			acked = append(acked, string(rec.Data))
+			mu.Unlock()
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	worker.Start(ctx)
+
+	worker.Enqueue([]byte(`{"n":0}`))
+	worker.Enqueue([]byte(`{"n":1}`))
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&delivered) == 1 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	assert.Empty(t, acked, "the later payload waits for the earlier one")
+	mu.Unlock()
+
+	close(release)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(acked) == 2
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	worker.Wait()
+	assert.Equal(t, []string{`{"n":0}`, `{"n":1}`}, acked)
+}
+
+func TestWorkerStopsAckingAfterEviction(t *testing.T) {
+	utils.InitLogger(true)
+
+	queue := newMemoryQueue(0)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, queue.Append([]byte(fmt.Sprintf(`{"n":%d}`, i))))
+	}
+	records, err := queue.Peek(3)
+	require.NoError(t, err)
+
+	var acked []uint64
+	worker := NewWorker(WorkerOptions{Name: "test", Queue: queue, Encode: rawRecord, OnAck: func(rec Record) { acked = append(acked, rec.Seq) }})
+
+	require.NoError(t, queue.Ack(records[1].Seq))
+	worker.settle(records[1])
+	assert.Empty(t, acked)
+
+	// The first record leaves the queue without being delivered.
+	require.NoError(t, queue.Ack(records[0].Seq))
+	worker.checkEvicted(records[2].Seq)
+
+	require.NoError(t, queue.Ack(records[2].Seq))
+	worker.settle(records[2])
+	assert.Empty(t, acked, "positions stay before the dropped payload")
+}